@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenCredentials attaches a bearer token to every request, implementing credentials.PerRPCCredentials
+type tokenCredentials struct {
+	token string
+	// with a file, the token is read again whenever the file changes
+	path    string
+	modTime time.Time
+	lock    sync.Mutex
+}
+
+func newTokenCredentials(token string, path string) (*tokenCredentials, error) {
+	creds := &tokenCredentials{token: token, path: path}
+	if path != "" {
+		if _, err := creds.currentToken(); err != nil {
+			return nil, err
+		}
+	}
+	return creds, nil
+}
+
+// currentToken returns the token, reading the file again if it was modified since the last read
+func (t *tokenCredentials) currentToken() (string, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.path == "" {
+		return t.token, nil
+	}
+
+	info, err := os.Stat(t.path)
+	if err != nil {
+		return "", fmt.Errorf("could not read AuthTokenFile %s: %w", t.path, err)
+	}
+	if t.token != "" && info.ModTime().Equal(t.modTime) {
+		return t.token, nil
+	}
+	content, err := os.ReadFile(t.path)
+	if err != nil {
+		return "", fmt.Errorf("could not read AuthTokenFile %s: %w", t.path, err)
+	}
+	token := strings.TrimSpace(string(content))
+	if token == "" {
+		return "", fmt.Errorf("AuthTokenFile %s is empty", t.path)
+	}
+	t.token, t.modTime = token, info.ModTime()
+	return t.token, nil
+}
+
+// GetRequestMetadata returns the authorization header of a request
+func (t *tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	token, err := t.currentToken()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"authorization": "Bearer " + token}, nil
+}
+
+// RequireTransportSecurity follows the TLS flag, so that plaintext local setups can send the token
+func (t *tokenCredentials) RequireTransportSecurity() bool {
+	return *TLS
+}
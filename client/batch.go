@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// batchRow holds the outcome of a batch of BatchSize
+type batchRow struct {
+	batch     int
+	succeeded int
+	failed    int
+	wallClock time.Duration
+	latency   latencySummary
+}
+
+// the batches of the measured requests, in order
+var batchRows []batchRow
+
+// runBatches sends requestCount requests, or until ctx is done in duration mode, in batches of BatchSize:
+// each batch is launched at once, and the next one WaitBetweenBatches after it completed. It returns the requests launched
+func runBatches(ctx context.Context, requestCount int) int {
+	launched := 0
+	for batch := 1; runDuration > 0 || launched < requestCount; batch++ {
+		if batch > 1 && waitBetweenBatches > 0 {
+			select {
+			case <-time.After(waitBetweenBatches):
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		size := *BatchSize
+		if runDuration == 0 {
+			size = min(size, requestCount-launched)
+		}
+		launched += runBatch(ctx, batch, size)
+	}
+	return launched
+}
+
+// runBatch launches size requests at once and waits for them, recording the statistics of the batch.
+// It returns the requests launched
+func runBatch(ctx context.Context, batch int, size int) int {
+	// a collector per batch, so that its results are all recorded once it is stopped
+	latenciesLock.Lock()
+	from := len(latencies)
+	latenciesLock.Unlock()
+	counterLock.Lock()
+	completedFrom, failedFrom := completedCount, failedCount
+	counterLock.Unlock()
+
+	d := newDispatcher(size, 0, 0, 0)
+	results, stopCollecting := collectResults(size)
+	start := time.Now()
+	for i := 0; i < size; i++ {
+		if !d.next(ctx) {
+			break
+		}
+		d.launch(func() { convolutionalRun(false, results) })
+	}
+	waitRequests()
+	stopCollecting()
+	wallClock := time.Since(start)
+
+	latenciesLock.Lock()
+	summary := summarizeLatencies(latencies[from:])
+	latenciesLock.Unlock()
+	counterLock.Lock()
+	completed, failed := completedCount-completedFrom, failedCount-failedFrom
+	counterLock.Unlock()
+
+	row := batchRow{batch, completed - failed, failed, wallClock, summary}
+	batchRows = append(batchRows, row)
+	mainLog.Printf("Batch %d completed. Succeeded: %d, Failed: %d, Wall-clock time: %v, Latency avg: %.2f ms, max: %.2f ms.",
+		batch, row.succeeded, row.failed, wallClock.Round(time.Millisecond), ms(summary.Mean), ms(summary.Max))
+	return d.launched
+}
+
+var batchHeader = []string{"batch", "succeeded", "failed", "wall_ms", "min_ms", "mean_ms", "p50_ms", "p95_ms", "p99_ms", "max_ms", "stddev_ms"}
+
+// fields formats the row as the columns of batchHeader
+func (row batchRow) fields() []string {
+	l := row.latency
+	fields := []string{strconv.Itoa(row.batch), strconv.Itoa(row.succeeded), strconv.Itoa(row.failed)}
+	for _, v := range []float64{ms(row.wallClock), ms(l.Min), ms(l.Mean), ms(l.P50), ms(l.P95), ms(l.P99), ms(l.Max), ms(l.StdDev)} {
+		fields = append(fields, strconv.FormatFloat(v, 'f', 2, 64))
+	}
+	return fields
+}
+
+// printBatches logs the batches as a table, a line per batch, then the spread of their mean latencies
+func printBatches() {
+	if len(batchRows) == 0 {
+		return
+	}
+	mainLog.Summaryf("Batch results:")
+	format := strings.TrimSuffix(strings.Repeat("%12s ", len(batchHeader)), " ")
+	header := make([]any, len(batchHeader))
+	for i, name := range batchHeader {
+		header[i] = name
+	}
+	mainLog.Summaryf(format, header...)
+	var means []time.Duration
+	for _, row := range batchRows {
+		fields := row.fields()
+		values := make([]any, len(fields))
+		for i, field := range fields {
+			values[i] = field
+		}
+		mainLog.Summaryf(format, values...)
+		if row.latency.Count > 0 {
+			means = append(means, row.latency.Mean)
+		}
+	}
+
+	// a batch far slower than the others shows up as a large spread
+	if len(means) > 1 {
+		spread := summarizeLatencies(means)
+		mainLog.Summaryf("Batch mean latency (ms). Min: %.2f, Avg: %.2f, Max: %.2f, StdDev: %.2f, CV: %.2f.",
+			ms(spread.Min), ms(spread.Mean), ms(spread.Max), ms(spread.StdDev), spread.CV)
+	}
+}
+
+// resetBatches forgets the batches sent so far
+func resetBatches() {
+	batchRows = nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"sort"
+	"sync"
+
+	pb "github.com/gmarseglia/SDCC-Common/proto"
+)
+
+var (
+	checksums     = map[int][]byte{}
+	checksumsLock sync.Mutex
+)
+
+// resultsDigest returns the SHA-256 of the little-endian bits of every result value, in order
+func resultsDigest(results []*pb.Matrix) []byte {
+	h := sha256.New()
+	buf := make([]byte, 4)
+	for _, result := range results {
+		for _, row := range result.Rows {
+			for _, value := range row.Values {
+				binary.LittleEndian.PutUint32(buf, math.Float32bits(value))
+				h.Write(buf)
+			}
+		}
+	}
+	return h.Sum(nil)
+}
+
+// recordChecksum keeps the digest of the results of request id
+func recordChecksum(id int, results []*pb.Matrix) {
+	digest := resultsDigest(results)
+	checksumsLock.Lock()
+	defer checksumsLock.Unlock()
+	checksums[id] = digest
+}
+
+// resetChecksums forgets the digests kept so far
+func resetChecksums() {
+	checksumsLock.Lock()
+	defer checksumsLock.Unlock()
+	checksums = map[int][]byte{}
+}
+
+// runChecksum returns the hex SHA-256 of the digests of all the requests ordered by id,
+// so that it does not depend on the order of completion
+func runChecksum() string {
+	checksumsLock.Lock()
+	defer checksumsLock.Unlock()
+
+	ids := make([]int, 0, len(checksums))
+	for id := range checksums {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	h := sha256.New()
+	for _, id := range ids {
+		h.Write(checksums[id])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
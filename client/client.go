@@ -2,73 +2,848 @@ package main
 
 import (
 	"context"
+	"encoding/binary"
+	"errors"
 	"flag"
 	"fmt"
+	"hash/fnv"
 	"log"
+	"math"
+	"math/rand"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding/gzip"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
 
 	pb "github.com/gmarseglia/SDCC-Common/proto"
 	"github.com/gmarseglia/SDCC-Common/utils"
+
+	"client/client"
 )
 
 const (
-	timeout    = 60 * time.Second
-	msgMaxSize = 4 * 1024 * 1024
+	shutdownGrace      = 5 * time.Second
+	defaultConcurrency = 16
+	defaultMaxMsgSize  = client.DefaultMaxMsgSize
+	maxMsgSizeCeiling  = 1024 * 1024 * 1024
 )
 
 var (
-	FrontAddr    = flag.String("FrontAddr", "", "The address to connect to.")
-	FrontPort    = flag.String("FrontPort", "", "The port of the master service.")
-	RequestCount = flag.String("RequestCount", "", "The number of requests to send.")
-	Verbose      = flag.Bool("Verbose", false, "Enable verbose output.")
-	TargetSize   = flag.Int("TargetSize", -1, "The target size of the image.")
-	KernelNum    = flag.Int("KernelNum", -1, "The number of kernels.")
-	KernelSize   = flag.Int("KernelSize", -1, "The size of the kernel.")
-	AvgPoolSize  = flag.Int("AvgPoolSize", -1, "The size of the average pooling.")
-	UseSigmoid   = flag.Bool("UseSigmoid", false, "Use sigmoid function.")
-	RandomValues = flag.Bool("RandomValues", false, "Use random values.")
-	ManualValues = flag.Bool("ManualValues", false, "Use manual values.")
-	counter      int
-	counterLock  sync.Mutex
-	wg           sync.WaitGroup
-	c            pb.FrontClient
+	Seed                = flag.String("Seed", "", "The seed of the random values, time-based when not given.")
+	Verify              = flag.Bool("Verify", false, "Verify the results against a local reference computation.")
+	StrictResults       = flag.Bool("StrictResults", false, "Fail the requests with missing or extra results, instead of only logging them.")
+	Tolerance           = flag.String("Tolerance", "", "The maximum absolute difference allowed by Verify.")
+	VerifySample        = flag.String("VerifySample", "", "The fraction of the requests, from 0 to 1, verified by Verify, drawn from Seed.")
+	ExpectChecksum      = flag.String("ExpectChecksum", "", "The expected hex SHA-256 checksum of all the results of the run.")
+	PrintChecksum       = flag.Bool("PrintChecksum", false, "Print the SHA-256 checksum of all the results of the run.")
+	DryRun              = flag.Bool("DryRun", false, "Build the requests without connecting or sending them.")
+	LogFormat           = flag.String("LogFormat", "", "The format of the logs: text, json.")
+	TraceParent         = flag.String("TraceParent", "", "The prefix of the x-request-id sent with each request, followed by the request number.")
+	Progress            = flag.Bool("Progress", false, "Show a progress bar, disabled when stdout is not a terminal, the logs are JSON or the request logs are on stdout.")
+	LogFile             = flag.String("LogFile", "", "The path of a file to write the logs to, instead of stdout.")
+	LogTee              = flag.Bool("LogTee", false, "Write the logs to stdout as well as to LogFile.")
+	LogLevel            = flag.String("LogLevel", "", "The messages to print: quiet (summary and errors), info, debug.")
+	RetryFailed         = flag.Bool("RetryFailed", false, "Send again the failed requests after the run, up to MaxRetries times.")
+	Histogram           = flag.Bool("Histogram", false, "Print a histogram of the latencies after the run.")
+	HistogramBuckets    = flag.Int("HistogramBuckets", -1, "The number of bars of the latency histogram.")
+	PrintConfig         = flag.Bool("PrintConfig", false, "Print the resolved parameters as a YAML Config and exit.")
+	ConfigFile          = flag.String("Config", "", "The path of a YAML file with the parameters, overridden by explicit flags.")
+	FrontAddr           = flag.String("FrontAddr", "", "The address to connect to, or a comma-separated list of addresses to balance across.")
+	CompareAddr         = flag.String("CompareAddr", "", "The address of a second front service, whose results are compared with the ones of FrontAddr.")
+	FrontPort           = flag.String("FrontPort", "", "The port of the master service.")
+	RequestCount        = flag.String("RequestCount", "", "The number of requests to send.")
+	RecordRequests      = flag.String("RecordRequests", "", "The path of a file to record the measured requests to, for ReplayRequests.")
+	ReplayRequests      = flag.String("ReplayRequests", "", "The path of a file recorded with RecordRequests, whose requests are sent instead of generated ones.")
+	KernelDir           = flag.String("KernelDir", "", "The path of a directory of CSV files with a kernel each.")
+	TargetImage         = flag.String("TargetImage", "", "The path of a PNG image used as the target, center-cropped to a square.")
+	NumpyFile           = flag.String("NumpyFile", "", "The path of a .npz file with the target and kernels arrays, or a .npy file with either.")
+	TargetFile          = flag.String("TargetFile", "", "The path of a CSV file with the target matrix.")
+	ResultLimit         = flag.Int("ResultLimit", -1, "The number of results output for each request, the first ones (0 for all).")
+	Reduce              = flag.String("Reduce", "", "Log each result reduced to a scalar instead of printing it: sum, mean, l2norm, max.")
+	PrintPrecision      = flag.Int("PrintPrecision", -1, "The decimal places of the matrices printed in verbose mode.")
+	PrintMax            = flag.Int("PrintMax", -1, "The rows and columns of the matrices printed in verbose mode, 0 for all of them.")
+	Verbose             = flag.Bool("Verbose", false, "Enable verbose output.")
+	SizeSweep           = flag.String("SizeSweep", "", "A comma-separated list of target sizes, the requests are sent once per size.")
+	TargetSize          = flag.Int("TargetSize", -1, "The target size of the image.")
+	KernelNum           = flag.Int("KernelNum", -1, "The number of kernels.")
+	KernelSize          = flag.Int("KernelSize", -1, "The size of the kernel.")
+	AvgPoolSize         = flag.Int("AvgPoolSize", -1, "The size of the average pooling.")
+	Profile             = profileFlag("Profile", "A request profile of a mixed workload, as name:targetSize=500,kernelNum=10,weight=2, repeatable.")
+	NoPool              = flag.Bool("NoPool", false, "Disable the average pooling, as AvgPoolSize=1.")
+	UseSigmoid          = flag.Bool("UseSigmoid", false, "Use sigmoid function, as Activation=sigmoid.")
+	Activation          = flag.String("Activation", "", "The activation function: none, sigmoid, relu, tanh.")
+	Precision           = flag.String("Precision", "", "The precision of the matrices, only float32 is supported by the front service.")
+	Fill                = flag.String("Fill", "", "The values of the generated matrices: zeros, ones, random, manual.")
+	KernelDist          = flag.String("KernelDist", "", "The distribution of the random kernels: uniform, normal.")
+	KernelMean          = flag.String("KernelMean", "", "The mean of the random kernels.")
+	KernelStdDev        = flag.String("KernelStdDev", "", "The standard deviation of the random kernels.")
+	ValueMin            = flag.String("ValueMin", "", "The lowest value of the generated matrices, lower values are clamped to it.")
+	ValueMax            = flag.String("ValueMax", "", "The highest value of the generated matrices, higher values are clamped to it.")
+	ShareInput          = flag.Bool("ShareInput", false, "Generate the matrices once, and send the same ones with every request.")
+	RandomValues        = flag.Bool("RandomValues", false, "Use random values, as Fill=random.")
+	ManualValues        = flag.Bool("ManualValues", false, "Use manual values, as Fill=manual.")
+	PrintSizes          = flag.Bool("PrintSizes", false, "Log the encoded size of each request and reply, with the estimated size.")
+	MaxMsgSize          = flag.Int("MaxMsgSize", -1, "The maximum message size in bytes.")
+	TLS                 = flag.Bool("TLS", false, "Use TLS to connect to the front service.")
+	CACert              = flag.String("CACert", "", "The path of the CA certificate bundle used to verify the server.")
+	ClientCert          = flag.String("ClientCert", "", "The path of the client certificate for mutual TLS.")
+	ClientKey           = flag.String("ClientKey", "", "The path of the client private key for mutual TLS.")
+	SplitKernels        = flag.Bool("SplitKernels", false, "Split the requests larger than MaxMsgSize into sub-requests by kernels, instead of rejecting them.")
+	AuthToken           = flag.String("AuthToken", "", "The bearer token sent with every request.")
+	AuthTokenFile       = flag.String("AuthTokenFile", "", "The path of a file with the bearer token, read again when it changes.")
+	Timeout             = flag.String("Timeout", "", "The timeout of each request, as a duration (e.g. 90s, 2m).")
+	SoftTimeout         = flag.String("SoftTimeout", "", "The time after which an attempt still waiting is logged as slow, as a duration (0 to disable).")
+	ConnectTimeout      = flag.String("ConnectTimeout", "", "The timeout of the connection to the front service, as a duration.")
+	WaitForReady        = flag.Bool("WaitForReady", true, "Wait for the connection to be ready before sending requests.")
+	Discover            = flag.Bool("Discover", false, "Check with gRPC reflection that the server serves the ConvolutionalLayer method before sending.")
+	HealthCheck         = flag.Bool("HealthCheck", true, "Check that the front service is serving before sending requests.")
+	Compression         = flag.String("Compression", "", "The compression of requests and responses: none, gzip.")
+	KeepaliveTime       = flag.String("KeepaliveTime", "", "The interval of keepalive pings, as a duration (0 disables them).")
+	KeepaliveTimeout    = flag.String("KeepaliveTimeout", "", "The time to wait for a keepalive ack before closing the connection.")
+	ResultDir           = flag.String("ResultDir", "", "The path of a directory to write each result matrix to as a CSV file.")
+	ResultImageDir      = flag.String("ResultImageDir", "", "The path of a directory to write each result matrix to as a PNG image.")
+	OtelEndpoint        = flag.String("OtelEndpoint", "", "The URL of the OTLP gRPC collector of the traces, e.g. http://localhost:4317, no tracing when not given.")
+	MetricsAddr         = flag.String("MetricsAddr", "", "The address to expose Prometheus metrics on (e.g. :9100).")
+	JSONOut             = flag.String("JSONOut", "", "The path of a JSON file to write the run summary to.")
+	HdrOut              = flag.String("HdrOut", "", "The path of a file to write the latencies to, in the HdrHistogram log format.")
+	PrintIDMap          = flag.Bool("PrintIDMap", false, "Print the ID assigned by the server to each request at the end of the run.")
+	CSVOut              = flag.String("CSVOut", "", "The path of a CSV file to write a row per request to.")
+	Warmup              = flag.Int("Warmup", -1, "The number of warmup requests sent first and excluded from the statistics.")
+	Duration            = flag.String("Duration", "", "Send requests continuously for this duration instead of RequestCount (0 to disable).")
+	Rate                = flag.String("Rate", "", "The number of requests to launch per second (0 for no limit).")
+	RampUp              = flag.String("RampUp", "", "The duration over which the launch rate grows linearly from 0 to Rate.")
+	LaunchDelay         = flag.String("LaunchDelay", "", "The delay between request launches, as a duration (0 for a burst).")
+	Connections         = flag.Int("Connections", -1, "The number of connections to each front address, the requests are spread across them.")
+	MaxInFlightBytes    = flag.Int("MaxInFlightBytes", -1, "The maximum estimated memory in bytes of the requests in flight at once (0 for no limit).")
+	Concurrency         = flag.Int("Concurrency", -1, "The maximum number of requests in flight at once.")
+	BatchSize           = flag.Int("BatchSize", -1, "Send the requests in batches of this size, each launched at once after the previous completed (0 to disable).")
+	WaitBetweenBatches  = flag.String("WaitBetweenBatches", "", "The pause between a batch of BatchSize completing and the next, as a duration.")
+	AbortOnFatal        = flag.Bool("AbortOnFatal", true, "Abort all the requests on the first error no retry can fix, as InvalidArgument or Unauthenticated.")
+	StopOnErrorCount    = flag.Int("StopOnErrorCount", -1, "Abort the remaining requests once that many have failed (0 for never).")
+	FailFast            = flag.Bool("FailFast", false, "Abort the remaining requests on the first failure.")
+	PermitWithoutStream = flag.Bool("PermitWithoutStream", false, "Send keepalive pings even without in-flight requests.")
+	MaxRetries          = flag.Int("MaxRetries", -1, "The maximum number of retries of a request on transient failures.")
+	RetryBackoff        = flag.String("RetryBackoff", "", "The base backoff between retries, as a duration.")
+	MaxBackoff          = flag.String("MaxBackoff", "", "The longest backoff between retries, as a duration (0 for no limit).")
+	BackoffPolicy       = flag.String("BackoffPolicy", "", "The backoff between retries: constant, exponential, exponential-jitter.")
+	InjectFailureRate   = flag.String("InjectFailureRate", "", "The probability of failing each attempt with Unavailable without sending it, to test the retries.")
+	RetryBudget         = flag.String("RetryBudget", "", "The largest share of all the attempts of the run spent on retries, as 0.2 or 20%.")
+	connectTimeout      time.Duration
+	keepaliveTime       time.Duration
+	keepaliveTimeout    time.Duration
+	retryBudget         = -1.0
+	injectFailureRate   float64
+	frontOptions        client.Options
+	launchDelay         time.Duration
+	rampUp              time.Duration
+	waitBetweenBatches  time.Duration
+	launchRate          float64
+	tolerance           float64
+	verifySample        float64
+	kernelMean          float64
+	kernelStdDev        float64
+	valueMin            = math.Inf(-1)
+	valueMax            = math.Inf(1)
+	seed                int64
+	runDuration         time.Duration
+	targetMatrix        [][]float32
+	kernelMatrices      [][][]float32
+	counter             atomic.Int64
+	completedCount      int
+	abortedCount        int
+	failedCount         int
+	builtCount          int
+	slowCount           atomic.Int64
+	injectedCount       atomic.Int64
+	verifiedCount       atomic.Int64
+	verifyFailedCount   atomic.Int64
+	rootCtx             context.Context
+	rootCancel          context.CancelFunc
+	abortReason         string
+	abortOnce           sync.Once
+	counterLock         sync.Mutex
+	wg                  sync.WaitGroup
 )
 
 func setupFields() {
+	// first, so that the following messages use the format
+	utils.SetupFieldOptional(LogFormat, "LogFormat", "text")
+	if err := setupLogFormat(*LogFormat); err != nil {
+		mainLog.Errorf("LogFormat must be one of: text, json.")
+		exit(1)
+	}
+	utils.SetupFieldOptional(LogFile, "LogFile", "")
+	utils.SetupFieldBool(LogTee, "LogTee")
+	if *LogFile != "" {
+		if err := setupLogFile(*LogFile, *LogTee); err != nil {
+			mainLog.Errorf("Could not open LogFile. More:\n%v", err)
+			exit(1)
+		}
+	} else if *LogTee {
+		mainLog.Errorf("LogTee requires LogFile.")
+		exit(1)
+	}
+	utils.SetupFieldOptional(LogLevel, "LogLevel", "info")
+	if err := setupLogLevel(*LogLevel); err != nil {
+		mainLog.Errorf("LogLevel must be one of: quiet, info, debug.")
+		exit(1)
+	}
+
 	utils.SetupFieldMandatory(FrontAddr, "FrontAddr", func() {
-		log.Printf("[Main]: FrontAddr field is mandatory.")
-		exit()
+		mainLog.Errorf("FrontAddr field is mandatory.")
+		exit(1)
 	})
 	utils.SetupFieldOptional(FrontPort, "FrontPort", "55555")
-	utils.SetupFieldOptional(RequestCount, "RequestCount", "1")
+	utils.SetupFieldOptional(CompareAddr, "CompareAddr", "")
+	setupReplay()
 	utils.SetupFieldBool(Verbose, "Verbose")
-	utils.SetupFieldInt(false, TargetSize, "TargetSize", 500, nil)
-	utils.SetupFieldInt(false, KernelNum, "KernelNum", 180, nil)
-	utils.SetupFieldInt(false, KernelSize, "KernelSize", 3, nil)
+	utils.SetupFieldInt(false, ResultLimit, "ResultLimit", 0, nil)
+	if *ResultLimit < 0 {
+		mainLog.Errorf("ResultLimit must not be negative.")
+		exit(1)
+	}
+	utils.SetupFieldOptional(Reduce, "Reduce", "")
+	if *Reduce != "" && *Reduce != "sum" && *Reduce != "mean" && *Reduce != "l2norm" && *Reduce != "max" {
+		mainLog.Errorf("Reduce must be one of: sum, mean, l2norm, max.")
+		exit(1)
+	}
+	utils.SetupFieldInt(false, PrintPrecision, "PrintPrecision", 4, nil)
+	utils.SetupFieldInt(false, PrintMax, "PrintMax", 10, nil)
+	if *PrintPrecision < 0 || *PrintMax < 0 {
+		mainLog.Errorf("PrintPrecision and PrintMax must not be negative.")
+		exit(1)
+	}
+	setupNumpy()
+	setupTarget()
+	setupKernels()
+	if *TargetSize <= 0 {
+		mainLog.Errorf("TargetSize must be positive, got: %d", *TargetSize)
+		exit(1)
+	}
+	if *KernelNum < 0 || *KernelSize < 0 {
+		mainLog.Errorf("KernelNum and KernelSize must not be negative, got: %d and %d", *KernelNum, *KernelSize)
+		exit(1)
+	}
+
+	// NoPool is an alias of AvgPoolSize=1, a window of a single value leaving the results unpooled
+	utils.SetupFieldBool(NoPool, "NoPool")
+	if *NoPool {
+		if *AvgPoolSize != -1 && *AvgPoolSize != 1 {
+			mainLog.Errorf("NoPool is given, but AvgPoolSize is %d.", *AvgPoolSize)
+			exit(1)
+		}
+		*AvgPoolSize = 1
+	}
 	utils.SetupFieldInt(false, AvgPoolSize, "AvgPoolSize", 500, nil)
 	utils.SetupFieldBool(UseSigmoid, "UseSigmoid")
+	utils.SetupFieldOptional(Activation, "Activation", "")
 	utils.SetupFieldBool(RandomValues, "RandomValues")
 	utils.SetupFieldBool(ManualValues, "ManualValues")
+	utils.SetupFieldOptional(Fill, "Fill", "")
+	utils.SetupFieldBool(ShareInput, "ShareInput")
+	utils.SetupFieldOptional(Precision, "Precision", "float32")
+	utils.SetupFieldInt(false, MaxMsgSize, "MaxMsgSize", defaultMaxMsgSize, nil)
+	utils.SetupFieldBool(TLS, "TLS")
+	utils.SetupFieldOptional(CACert, "CACert", "")
+	utils.SetupFieldOptional(ClientCert, "ClientCert", "")
+	utils.SetupFieldOptional(ClientKey, "ClientKey", "")
+	utils.SetupFieldOptional(AuthToken, "AuthToken", "")
+	utils.SetupFieldOptional(AuthTokenFile, "AuthTokenFile", "")
+	utils.SetupFieldOptional(Timeout, "Timeout", "60s")
+	utils.SetupFieldOptional(SoftTimeout, "SoftTimeout", "0s")
+	utils.SetupFieldOptional(ConnectTimeout, "ConnectTimeout", "10s")
+	utils.SetupFieldBool(WaitForReady, "WaitForReady")
+	utils.SetupFieldBool(HealthCheck, "HealthCheck")
+	utils.SetupFieldBool(Discover, "Discover")
+	utils.SetupFieldOptional(Compression, "Compression", "none")
+	utils.SetupFieldOptional(KeepaliveTime, "KeepaliveTime", "0s")
+	utils.SetupFieldOptional(KeepaliveTimeout, "KeepaliveTimeout", "20s")
+	utils.SetupFieldBool(PermitWithoutStream, "PermitWithoutStream")
+	utils.SetupFieldBool(FailFast, "FailFast")
+	utils.SetupFieldInt(false, StopOnErrorCount, "StopOnErrorCount", 0, nil)
+	if *StopOnErrorCount < 0 {
+		mainLog.Errorf("StopOnErrorCount must not be negative.")
+		exit(1)
+	}
+	utils.SetupFieldBool(AbortOnFatal, "AbortOnFatal")
+	utils.SetupFieldInt(false, Concurrency, "Concurrency", 0, nil)
+	utils.SetupFieldInt(false, MaxInFlightBytes, "MaxInFlightBytes", 0, nil)
+	utils.SetupFieldInt(false, Connections, "Connections", 1, nil)
+	utils.SetupFieldInt(false, BatchSize, "BatchSize", 0, nil)
+	utils.SetupFieldOptional(WaitBetweenBatches, "WaitBetweenBatches", "0s")
+	utils.SetupFieldOptional(LaunchDelay, "LaunchDelay", "100ms")
+	utils.SetupFieldOptional(RampUp, "RampUp", "0s")
+	utils.SetupFieldOptional(Rate, "Rate", "0")
+	utils.SetupFieldOptional(Duration, "Duration", "0s")
+	utils.SetupFieldInt(false, Warmup, "Warmup", 0, nil)
+	utils.SetupFieldOptional(CSVOut, "CSVOut", "")
+	utils.SetupFieldOptional(JSONOut, "JSONOut", "")
+	utils.SetupFieldOptional(HdrOut, "HdrOut", "")
+	utils.SetupFieldBool(PrintIDMap, "PrintIDMap")
+	utils.SetupFieldOptional(MetricsAddr, "MetricsAddr", "")
+	utils.SetupFieldOptional(OtelEndpoint, "OtelEndpoint", "")
+	utils.SetupFieldOptional(ResultImageDir, "ResultImageDir", "")
+	utils.SetupFieldOptional(ResultDir, "ResultDir", "")
+	utils.SetupFieldOptional(Seed, "Seed", "")
+	utils.SetupFieldBool(DryRun, "DryRun")
+	utils.SetupFieldBool(Verify, "Verify")
+	utils.SetupFieldOptional(ExpectChecksum, "ExpectChecksum", "")
+	utils.SetupFieldBool(PrintChecksum, "PrintChecksum")
+	utils.SetupFieldOptional(Tolerance, "Tolerance", "1e-3")
+	utils.SetupFieldOptional(VerifySample, "VerifySample", "1")
+	utils.SetupFieldBool(StrictResults, "StrictResults")
+	utils.SetupFieldInt(false, MaxRetries, "MaxRetries", 0, nil)
+	utils.SetupFieldOptional(RetryBackoff, "RetryBackoff", "100ms")
+	utils.SetupFieldOptional(MaxBackoff, "MaxBackoff", "0")
+	utils.SetupFieldOptional(BackoffPolicy, "BackoffPolicy", "exponential-jitter")
+	utils.SetupFieldOptional(RetryBudget, "RetryBudget", "")
+	utils.SetupFieldOptional(InjectFailureRate, "InjectFailureRate", "0")
+	utils.SetupFieldOptional(TraceParent, "TraceParent", "")
+	utils.SetupFieldBool(SplitKernels, "SplitKernels")
+	utils.SetupFieldBool(PrintSizes, "PrintSizes")
+	utils.SetupFieldBool(Progress, "Progress")
+	utils.SetupFieldBool(RetryFailed, "RetryFailed")
+	utils.SetupFieldBool(Histogram, "Histogram")
+	utils.SetupFieldInt(false, HistogramBuckets, "HistogramBuckets", 10, nil)
+
+	if (*ClientCert == "") != (*ClientKey == "") {
+		mainLog.Errorf("ClientCert and ClientKey must be given together.")
+		exit(1)
+	}
+	if *ClientCert != "" && !*TLS {
+		mainLog.Errorf("ClientCert and ClientKey require TLS to be enabled.")
+		exit(1)
+	}
+
+	// RandomValues and ManualValues are aliases of Fill, ones when none is given
+	if *RandomValues && *ManualValues {
+		mainLog.Errorf("RandomValues and ManualValues cannot be given together.")
+		exit(1)
+	}
+	alias, aliasFlag := "", ""
+	if *RandomValues {
+		alias, aliasFlag = "random", "RandomValues"
+	} else if *ManualValues {
+		alias, aliasFlag = "manual", "ManualValues"
+	}
+	if *Fill == "" {
+		*Fill = alias
+		if alias == "" {
+			*Fill = "ones"
+		}
+	} else if alias != "" && alias != *Fill {
+		mainLog.Errorf("Fill is %s, but %s is given.", *Fill, aliasFlag)
+		exit(1)
+	}
+	if *Fill != "zeros" && *Fill != "ones" && *Fill != "random" && *Fill != "manual" {
+		mainLog.Errorf("Fill must be one of: zeros, ones, random, manual.")
+		exit(1)
+	}
+
+	// the distribution of the kernels matches the uniform values in [-1, 1] when not given
+	if (*KernelDist != "" || *KernelMean != "" || *KernelStdDev != "") && *Fill != "random" {
+		mainLog.Errorf("KernelDist, KernelMean and KernelStdDev require Fill=random.")
+		exit(1)
+	}
+	utils.SetupFieldOptional(KernelDist, "KernelDist", "uniform")
+	utils.SetupFieldOptional(KernelMean, "KernelMean", "0")
+	utils.SetupFieldOptional(KernelStdDev, "KernelStdDev", strconv.FormatFloat(1/math.Sqrt(3), 'g', -1, 64))
+	if *KernelDist != "uniform" && *KernelDist != "normal" {
+		mainLog.Errorf("KernelDist must be one of: uniform, normal.")
+		exit(1)
+	}
+	var distErr error
+	if kernelMean, distErr = strconv.ParseFloat(*KernelMean, 64); distErr != nil {
+		mainLog.Errorf("KernelMean must be a number, got: %s", *KernelMean)
+		exit(1)
+	}
+	if kernelStdDev, distErr = strconv.ParseFloat(*KernelStdDev, 64); distErr != nil || kernelStdDev < 0 {
+		mainLog.Errorf("KernelStdDev must be a non-negative number, got: %s", *KernelStdDev)
+		exit(1)
+	}
+
+	// the generated values are not bounded when not given
+	utils.SetupFieldOptional(ValueMin, "ValueMin", "")
+	utils.SetupFieldOptional(ValueMax, "ValueMax", "")
+	if *ValueMin != "" {
+		if valueMin, distErr = strconv.ParseFloat(*ValueMin, 64); distErr != nil {
+			mainLog.Errorf("ValueMin must be a number, got: %s", *ValueMin)
+			exit(1)
+		}
+	}
+	if *ValueMax != "" {
+		if valueMax, distErr = strconv.ParseFloat(*ValueMax, 64); distErr != nil {
+			mainLog.Errorf("ValueMax must be a number, got: %s", *ValueMax)
+			exit(1)
+		}
+	}
+	if valueMin > valueMax {
+		mainLog.Errorf("ValueMin %s must not be greater than ValueMax %s.", *ValueMin, *ValueMax)
+		exit(1)
+	}
+
+	// UseSigmoid is an alias of Activation, none when not given
+	if *Activation == "" {
+		*Activation = "none"
+		if *UseSigmoid {
+			*Activation = "sigmoid"
+		}
+	} else if *UseSigmoid && *Activation != "sigmoid" {
+		mainLog.Errorf("Activation is %s, but UseSigmoid is given.", *Activation)
+		exit(1)
+	}
+	switch *Activation {
+	case "none", "sigmoid":
+	case "relu", "tanh":
+		// the proto can only request the sigmoid
+		mainLog.Errorf("Activation %s is not supported, the front service only applies the sigmoid.", *Activation)
+		exit(1)
+	default:
+		mainLog.Errorf("Activation must be one of: none, sigmoid, relu, tanh.")
+		exit(1)
+	}
+	*UseSigmoid = *Activation == "sigmoid"
+
+	// the proto has only float32 matrices
+	if *Precision == "float64" {
+		mainLog.Errorf("Precision float64 is not supported, the front service exchanges float32 matrices.")
+		exit(1)
+	}
+	if *Precision != "float32" {
+		mainLog.Errorf("Precision must be float32.")
+		exit(1)
+	}
+
+	if *AuthToken != "" && *AuthTokenFile != "" {
+		mainLog.Errorf("AuthToken and AuthTokenFile cannot be given together.")
+		exit(1)
+	}
+
+	if *MaxMsgSize <= 0 || *MaxMsgSize > maxMsgSizeCeiling {
+		mainLog.Errorf("MaxMsgSize must be between 1 and %d bytes.", maxMsgSizeCeiling)
+		exit(1)
+	}
+
+	if *Compression != "none" && *Compression != gzip.Name {
+		mainLog.Errorf("Compression must be one of: none, %s.", gzip.Name)
+		exit(1)
+	}
+
+	if *AvgPoolSize <= 0 {
+		mainLog.Errorf("AvgPoolSize must be positive, got: %d", *AvgPoolSize)
+		exit(1)
+	}
+
+	if *Concurrency < 0 {
+		mainLog.Errorf("Concurrency must not be negative.")
+		exit(1)
+	}
+	if *MaxInFlightBytes < 0 {
+		mainLog.Errorf("MaxInFlightBytes must not be negative.")
+		exit(1)
+	}
+	if *MaxInFlightBytes > 0 {
+		inFlightBytes = newByteBudget(int64(*MaxInFlightBytes))
+	}
+
+	if *Connections <= 0 {
+		mainLog.Errorf("Connections must be positive, got: %d", *Connections)
+		exit(1)
+	}
+
+	if *Warmup < 0 {
+		mainLog.Errorf("Warmup must not be negative.")
+		exit(1)
+	}
+
+	if *HistogramBuckets <= 0 {
+		mainLog.Errorf("HistogramBuckets must be positive, got: %d", *HistogramBuckets)
+		exit(1)
+	}
+
+	if *MaxRetries < 0 {
+		mainLog.Errorf("MaxRetries must not be negative.")
+		exit(1)
+	}
+
+	frontOptions.Timeout = parseDuration(*Timeout, "Timeout", false)
+	connectTimeout = parseDuration(*ConnectTimeout, "ConnectTimeout", false)
+	frontOptions.SoftTimeout = parseDuration(*SoftTimeout, "SoftTimeout", true)
+	if frontOptions.SoftTimeout >= frontOptions.Timeout {
+		mainLog.Errorf("SoftTimeout must be lower than Timeout %v, got: %v", frontOptions.Timeout, frontOptions.SoftTimeout)
+		exit(1)
+	}
+	launchDelay = parseDuration(*LaunchDelay, "LaunchDelay", true)
+	rampUp = parseDuration(*RampUp, "RampUp", true)
+	runDuration = parseDuration(*Duration, "Duration", true)
+
+	keepaliveTime = parseDuration(*KeepaliveTime, "KeepaliveTime", true)
+	keepaliveTimeout = parseDuration(*KeepaliveTimeout, "KeepaliveTimeout", false)
+
+	var err error
+	retryBackoff := parseDuration(*RetryBackoff, "RetryBackoff", true)
+	maxBackoff := parseDuration(*MaxBackoff, "MaxBackoff", true)
+	if maxBackoff > 0 && maxBackoff < retryBackoff {
+		mainLog.Errorf("MaxBackoff must not be lower than RetryBackoff %v, got: %v", retryBackoff, maxBackoff)
+		exit(1)
+	}
+	if frontOptions.Backoff, err = client.NewBackoff(*BackoffPolicy, retryBackoff, maxBackoff); err != nil {
+		mainLog.Errorf("BackoffPolicy must be one of: %s.", strings.Join(client.BackoffPolicies, ", "))
+		exit(1)
+	}
+	frontOptions.MaxRetries, frontOptions.MaxMsgSize, frontOptions.SplitKernels = *MaxRetries, *MaxMsgSize, *SplitKernels
+	if *Compression == gzip.Name {
+		frontOptions.CallOptions = []grpc.CallOption{grpc.UseCompressor(gzip.Name)}
+	}
+	// the calls are timed and measured for the statistics of the run
+	frontOptions.Interceptor, frontOptions.StatsHandler = callInterceptor, payloadStatsHandler{}
+
+	launchRate, err = strconv.ParseFloat(*Rate, 64)
+	if err != nil || launchRate < 0 {
+		mainLog.Errorf("Rate must be a non-negative number, got: %s", *Rate)
+		exit(1)
+	}
+	if rampUp > 0 && launchRate == 0 {
+		mainLog.Errorf("RampUp requires a Rate to ramp up to.")
+		exit(1)
+	}
+
+	// a batch is launched at once, so nothing paces its requests
+	if *BatchSize < 0 {
+		mainLog.Errorf("BatchSize must not be negative.")
+		exit(1)
+	}
+	waitBetweenBatches = parseDuration(*WaitBetweenBatches, "WaitBetweenBatches", true)
+	if *BatchSize == 0 && waitBetweenBatches > 0 {
+		mainLog.Errorf("WaitBetweenBatches requires a BatchSize.")
+		exit(1)
+	}
+	if *BatchSize > 0 && launchRate > 0 {
+		mainLog.Errorf("BatchSize and Rate cannot be used together, the batches replace the rate limiter.")
+		exit(1)
+	}
+
+	// without a budget only MaxRetries bounds the retries
+	if *RetryBudget != "" {
+		if retryBudget, err = parseRetryBudget(*RetryBudget); err != nil {
+			mainLog.Errorf("RetryBudget must be a fraction or a percentage of the attempts, got: %s", *RetryBudget)
+			exit(1)
+		}
+	}
+
+	// a testing aid, so its failures must not pass for the server's
+	injectFailureRate, err = strconv.ParseFloat(*InjectFailureRate, 64)
+	if err != nil || injectFailureRate < 0 || injectFailureRate > 1 {
+		mainLog.Errorf("InjectFailureRate must be a probability between 0 and 1, got: %s", *InjectFailureRate)
+		exit(1)
+	}
+	if injectFailureRate > 0 {
+		mainLog.Summaryf("WARNING, InjectFailureRate is %g: attempts fail with Unavailable without contacting the server.", injectFailureRate)
+	}
+
+	tolerance, err = strconv.ParseFloat(*Tolerance, 64)
+	if err != nil || tolerance < 0 {
+		mainLog.Errorf("Tolerance must be a non-negative number, got: %s", *Tolerance)
+		exit(1)
+	}
+	verifySample, err = strconv.ParseFloat(*VerifySample, 64)
+	if err != nil || verifySample < 0 || verifySample > 1 {
+		mainLog.Errorf("VerifySample must be a fraction from 0 to 1, got: %s", *VerifySample)
+		exit(1)
+	}
+	if verifySample < 1 && !*Verify {
+		mainLog.Errorf("VerifySample requires Verify.")
+		exit(1)
+	}
+
+	utils.SetupFieldOptional(SizeSweep, "SizeSweep", "")
+	if *SizeSweep != "" {
+		if sweepSizes, err = parseSizes(*SizeSweep); err != nil {
+			mainLog.Errorf("SizeSweep must be a comma-separated list of positive sizes. More:\n%v", err)
+			exit(1)
+		}
+		if targetMatrix != nil {
+			mainLog.Errorf("SizeSweep cannot be given with a target from TargetFile, TargetImage or NumpyFile.")
+			exit(1)
+		}
+		if replayRequests != nil {
+			mainLog.Errorf("SizeSweep cannot be given with ReplayRequests.")
+			exit(1)
+		}
+		// the sweep exits after the last size, the failed requests would only be held in memory
+		if *RetryFailed {
+			mainLog.Errorf("SizeSweep cannot be given with RetryFailed.")
+			exit(1)
+		}
+	}
+	setupProfiles()
+
+	// keep the time-based seed in the flag, so that the printed configuration reproduces the run
+	if *Seed == "" {
+		seed = time.Now().UnixNano()
+		*Seed = strconv.FormatInt(seed, 10)
+	} else if seed, err = strconv.ParseInt(*Seed, 10, 64); err != nil {
+		mainLog.Errorf("Seed must be an integer, got: %s", *Seed)
+		exit(1)
+	}
 }
 
-func exit() {
-	log.Printf("[Main]: All components stopped. Main component stopped. Goodbye.")
-	os.Exit(0)
+// setupReplay loads the requests of ReplayRequests and sets up RequestCount, by default the number of requests recorded
+func setupReplay() {
+	utils.SetupFieldOptional(RecordRequests, "RecordRequests", "")
+	utils.SetupFieldOptional(ReplayRequests, "ReplayRequests", "")
+	if *ReplayRequests == "" {
+		utils.SetupFieldOptional(RequestCount, "RequestCount", "1")
+		return
+	}
+	if *RecordRequests != "" {
+		mainLog.Errorf("RecordRequests and ReplayRequests cannot be given together.")
+		exit(1)
+	}
+
+	var err error
+	replayRequests, err = loadReplay(*ReplayRequests)
+	if err != nil {
+		mainLog.Errorf("Could not load ReplayRequests. More:\n%v", err)
+		exit(1)
+	}
+	utils.SetupFieldOptional(RequestCount, "RequestCount", strconv.Itoa(len(replayRequests)))
+	mainLog.Printf("Loaded %d requests from %s, the generation parameters are ignored.", len(replayRequests), *ReplayRequests)
 }
 
-func convolutionalRun() {
-	// Internal ID
-	counterLock.Lock()
-	counter++
-	id := counter
-	counterLock.Unlock()
+// setupNumpy loads the target and the kernels given in NumpyFile, checked by setupTarget and setupKernels
+func setupNumpy() {
+	utils.SetupFieldOptional(NumpyFile, "NumpyFile", "")
+	if *NumpyFile == "" {
+		return
+	}
+
+	var err error
+	targetMatrix, kernelMatrices, err = loadNumpy(*NumpyFile)
+	if err != nil {
+		mainLog.Errorf("Could not load NumpyFile. More:\n%v", err)
+		exit(1)
+	}
+
+	// the other sources cannot replace the arrays of the file
+	utils.SetupFieldOptional(TargetFile, "TargetFile", "")
+	utils.SetupFieldOptional(TargetImage, "TargetImage", "")
+	utils.SetupFieldOptional(KernelDir, "KernelDir", "")
+	if targetMatrix != nil && (*TargetFile != "" || *TargetImage != "") {
+		mainLog.Errorf("NumpyFile has a target, TargetFile and TargetImage cannot be given.")
+		exit(1)
+	}
+	if kernelMatrices != nil && *KernelDir != "" {
+		mainLog.Errorf("NumpyFile has kernels, KernelDir cannot be given.")
+		exit(1)
+	}
+}
+
+// setupKernels sets up KernelNum and KernelSize, inferring them from KernelDir or NumpyFile when not given
+func setupKernels() {
+	utils.SetupFieldOptional(KernelDir, "KernelDir", "")
+	source := *KernelDir
+	if kernelMatrices != nil {
+		source = *NumpyFile
+	}
+	if source == "" {
+		utils.SetupFieldInt(false, KernelNum, "KernelNum", 180, nil)
+		utils.SetupFieldInt(false, KernelSize, "KernelSize", 3, nil)
+		return
+	}
+
+	// -1 is left when KernelNum or KernelSize are not given
+	utils.SetupFieldInt(false, KernelNum, "KernelNum", -1, nil)
+	utils.SetupFieldInt(false, KernelSize, "KernelSize", -1, nil)
+
+	if kernelMatrices == nil {
+		var err error
+		kernelMatrices, err = loadKernelDir(*KernelDir)
+		if err != nil {
+			mainLog.Errorf("Could not load KernelDir. More:\n%v", err)
+			exit(1)
+		}
+	}
+	if *KernelNum != -1 && *KernelNum != len(kernelMatrices) {
+		mainLog.Errorf("KernelNum is %d, but %s has %d kernels.", *KernelNum, source, len(kernelMatrices))
+		exit(1)
+	}
+	if *KernelSize != -1 && *KernelSize != len(kernelMatrices[0]) {
+		mainLog.Errorf("KernelSize is %d, but the kernels in %s are %dx%d.", *KernelSize, source, len(kernelMatrices[0]), len(kernelMatrices[0]))
+		exit(1)
+	}
+	*KernelNum = len(kernelMatrices)
+	*KernelSize = len(kernelMatrices[0])
+	mainLog.Printf("Loaded %d kernels of size %d from %s.", *KernelNum, *KernelSize, source)
+}
+
+// setupTarget sets up TargetSize, inferring it from TargetFile, TargetImage or NumpyFile when not given
+func setupTarget() {
+	utils.SetupFieldOptional(TargetFile, "TargetFile", "")
+	utils.SetupFieldOptional(TargetImage, "TargetImage", "")
+	if *TargetFile != "" && *TargetImage != "" {
+		mainLog.Errorf("TargetFile and TargetImage cannot be given together.")
+		exit(1)
+	}
+	source := *TargetFile + *TargetImage
+	if targetMatrix != nil {
+		source = *NumpyFile
+	}
+	if source == "" {
+		utils.SetupFieldInt(false, TargetSize, "TargetSize", 500, nil)
+		return
+	}
+
+	// -1 is left when TargetSize is not given
+	utils.SetupFieldInt(false, TargetSize, "TargetSize", -1, nil)
+
+	var err error
+	if targetMatrix != nil {
+		// loaded by setupNumpy
+	} else if *TargetFile != "" {
+		targetMatrix, err = loadMatrixCSV(*TargetFile)
+	} else {
+		targetMatrix, err = loadMatrixPNG(*TargetImage)
+	}
+	if err != nil {
+		mainLog.Errorf("Could not load the target from %s. More:\n%v", source, err)
+		exit(1)
+	}
+	if *TargetSize == -1 {
+		*TargetSize = len(targetMatrix)
+		mainLog.Printf("TargetSize inferred from %s: %d", source, *TargetSize)
+	} else if *TargetSize != len(targetMatrix) {
+		mainLog.Errorf("TargetSize is %d, but %s is %dx%d.", *TargetSize, source, len(targetMatrix), len(targetMatrix))
+		exit(1)
+	}
+}
+
+// parseDuration parses the value of a duration field, exiting if it is invalid
+func parseDuration(value string, name string, allowZero bool) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 || (d == 0 && !allowZero) {
+		if allowZero {
+			mainLog.Errorf("%s must be a non-negative duration, got: %s", name, value)
+		} else {
+			mainLog.Errorf("%s must be a positive duration, got: %s", name, value)
+		}
+		exit(1)
+	}
+	return d
+}
+
+// shutdown releases the connections, the outputs, the request log, the metrics server and the tracer
+func shutdown() {
+	if pool != nil {
+		pool.close()
+	}
+	conns = nil
+	compareConn = nil
+	closeOutputs()
+	closeHdr()
+	closeRecord()
+	stopMetricsServer()
+	stopTracing()
+}
+
+// abortRun cancels the requests in flight and the remaining ones, the first reason given being reported at the end
+func abortRun(reason string) {
+	abortOnce.Do(func() { abortReason = reason })
+	rootCancel()
+}
+
+func exit(code int) {
+	shutdown()
+	mainLog.Summaryf("All components stopped. Main component stopped. Goodbye.")
+	closeLogFile()
+	os.Exit(code)
+}
+
+// convolutionalRun builds and sends a request, sending its RequestResult on results unless nil, as for the warmup requests
+func convolutionalRun(warmup bool, results chan<- *RequestResult) {
+	defer wg.Done()
+
+	// Internal ID, minted without taking counterLock, which only guards the outcome counts
+	id := int(counter.Add(1))
+
+	// warmup requests are labeled apart in the logs
+	name := fmt.Sprintf("Request #%d", id)
+	if warmup {
+		name = fmt.Sprintf("Warmup #%d", id)
+	}
+	// the correlation id sent to the server, to find the request in its logs
+	requestID := strconv.Itoa(id)
+	if warmup {
+		requestID = "warmup-" + requestID
+	}
+	if *TraceParent != "" {
+		requestID = *TraceParent + "-" + requestID
+	}
+	clog := clientLog.with("request_id", id).with("warmup", warmup).with("x_request_id", requestID)
+
+	// count the request as aborted, failed or completed once it returns
+	var err error
+	defer func() {
+		counterLock.Lock()
+		defer counterLock.Unlock()
+		if err != nil && rootCtx.Err() != nil {
+			abortedCount++
+			return
+		}
+		// a request built by a dry run is neither completed nor failed, as it was not sent
+		if err == nil && *DryRun {
+			builtCount++
+			return
+		}
+		completedCount++
+		if err != nil {
+			failedCount++
+			if *FailFast && failedCount == 1 {
+				clog.Errorf("%s failed, aborting the remaining requests.", name)
+				abortRun("FailFast, " + name + " failed")
+			} else if *AbortOnFatal && client.IsFatal(err) {
+				clog.Errorf("%s failed with %v, the other requests would fail as well, aborting them.", name, status.Code(err))
+				abortRun(fmt.Sprintf("AbortOnFatal, %s failed with %v", name, status.Code(err)))
+			} else if *StopOnErrorCount > 0 && failedCount == *StopOnErrorCount {
+				clog.Errorf("%s is failure %d, aborting the remaining requests.", name, failedCount)
+				abortRun(fmt.Sprintf("StopOnErrorCount, %d requests failed", failedCount))
+			}
+		}
+		if !warmup && bar != nil {
+			bar.update(completedCount, failedCount)
+		}
+	}()
+
+	// keep a record of the measured requests
+	rec := &RequestResult{ID: id}
+	if !warmup {
+		requestsInFlight.Inc()
+		defer requestsInFlight.Dec()
+	}
+	if results != nil {
+		defer func() {
+			// nothing was measured for a request built by a dry run
+			if err == nil && *DryRun {
+				return
+			}
+			rec.Err = err
+			results <- rec
+		}()
+	}
 
 	// Settings
 	targetSize := *TargetSize
@@ -78,38 +853,277 @@ func convolutionalRun() {
 	useKernels := kernelSize > 0
 	useSigmoid := *UseSigmoid
 
-	exptecedSize := max(
-		(targetSize*targetSize*4)+(kernelSize*kernelSize*kernelNum)*4,
-		targetSize*targetSize*kernelNum*4/(avgPoolSize*avgPoolSize))
+	// a replayed request brings its own settings
+	var replay *pb.ConvolutionalLayerFrontRequest
+	if replayRequests != nil {
+		replay = replayedRequest(id)
+		targetSize = len(replay.GetTarget().GetRows())
+		kernelNum = len(replay.GetKernel())
+		kernelSize = 0
+		if kernelNum > 0 {
+			kernelSize = len(replay.GetKernel()[0].GetRows())
+		}
+		avgPoolSize = int(replay.GetAvgPoolSize())
+		useKernels = replay.GetUseKernels()
+		useSigmoid = replay.GetUseSigmoid()
+	}
+	// a mixed workload draws the settings of the request from its profiles
+	if profiles != nil {
+		p := chooseProfile(id)
+		targetSize, kernelNum, kernelSize, avgPoolSize = p.targetSize, p.kernelNum, p.kernelSize, p.avgPoolSize
+		useKernels = kernelSize > 0
+		rec.Profile = p.name
+		name = fmt.Sprintf("%s (%s)", name, p.name)
+		clog = clog.with("profile", p.name)
+	}
+	activation := "none"
+	if useSigmoid {
+		activation = "sigmoid"
+	}
+	rec.TargetSize, rec.KernelNum, rec.KernelSize, rec.AvgPoolSize = targetSize, kernelNum, kernelSize, avgPoolSize
 
-	log.Printf("[Client]: Request #%d started. Target size: %d, Kernel size: %d, Kernel number: %d, Avg Pool Size: %d, Use Kernels: %v, Use Sigmoid: %v",
-		id, targetSize, kernelSize, kernelNum, avgPoolSize, useKernels, useSigmoid)
-	log.Printf("[Client]: Request #%d -> Expected size: %d, Expected results: %d", id, exptecedSize, kernelNum)
+	exptecedSize := client.ExpectedSize(targetSize, kernelSize, kernelNum, avgPoolSize)
 
-	if exptecedSize > msgMaxSize {
-		log.Printf("[Client]: Request #%d NOT SENT -> Size must lower than: %d", id, msgMaxSize)
-		wg.Done()
+	clog.Printf("%s started. x-request-id: %s, Target size: %d, Kernel size: %d, Kernel number: %d, Avg Pool Size: %d, Use Kernels: %v, Activation: %s",
+		name, requestID, targetSize, kernelSize, kernelNum, avgPoolSize, useKernels, activation)
+	clog.Debugf("%s -> Expected size: %d, Expected results: %d", name, exptecedSize, kernelNum)
+
+	if err = client.ValidateParams(targetSize, kernelSize, useKernels); err != nil {
+		clog.Errorf("%s NOT SENT -> %v", name, err)
+		err = clientError{err}
+		return
+	}
+
+	// too large requests are rejected before being built, or split by kernels if allowed
+	chunkSize, err := client.KernelsPerCall(targetSize, kernelSize, kernelNum, avgPoolSize, *MaxMsgSize, *SplitKernels)
+	if err != nil {
+		clog.Errorf("%s NOT SENT -> %v", name, err)
+		err = clientError{err}
 		return
 	}
+	if chunkSize < kernelNum {
+		clog.Printf("%s -> Splitting into sub-requests of at most %d kernels", name, chunkSize)
+	}
+
+	// bound the memory held by the requests in flight, a request and its reply taking up to exptecedSize each
+	if inFlightBytes != nil {
+		waitStart := time.Now()
+		var taken int64
+		if taken, err = inFlightBytes.take(rootCtx, 2*int64(exptecedSize)); err != nil {
+			clog.Errorf("%s NOT SENT -> Aborted while waiting for MaxInFlightBytes.", name)
+			return
+		}
+		defer inFlightBytes.give(taken)
+		if waited := time.Since(waitStart); waited >= time.Millisecond {
+			clog.Debugf("%s -> Waited %d ms for %d bytes of MaxInFlightBytes", name, waited.Milliseconds(), taken)
+		}
+	}
 
 	// Produce the request
+	buildStart := time.Now()
+	var frontRequest *pb.ConvolutionalLayerFrontRequest
+	var target [][]float32
+	if replay != nil {
+		// the request is sent as recorded
+		frontRequest = replay
+		target = utils.ProtoToMatrix(replay.GetTarget())
+	} else {
+		if *ShareInput {
+			frontRequest, target, err = sharedRequest(targetSize, kernelNum, kernelSize, avgPoolSize, useKernels, useSigmoid)
+		} else {
+			frontRequest, target, err = generateRequest(id, targetSize, kernelNum, kernelSize, avgPoolSize, useKernels, useSigmoid)
+		}
+		if err != nil {
+			clog.Errorf("%s NOT SENT -> %v", name, err)
+			err = clientError{err}
+			return
+		}
+	}
+
+	// mismatched kernels would fail on the server with a less precise error
+	if err = client.CheckKernelShape(frontRequest.Kernel, kernelSize); err != nil {
+		clog.Errorf("%s NOT SENT -> %v", name, err)
+		err = clientError{err}
+		return
+	}
+
+	// keep the measured requests, to send them again with ReplayRequests
+	if *RecordRequests != "" && !warmup {
+		if err = recordFrontRequest(frontRequest); err != nil {
+			clog.Errorf("%s NOT SENT -> Could not record the request. More:\n%v", name, err)
+			err = clientError{err}
+			return
+		}
+	}
+
+	buildTime := time.Since(buildStart)
+
+	// the encoded size against the estimate, which decides the rejections and the splits
+	if *PrintSizes {
+		clog.Printf("%s -> Request size: %d bytes, estimated: %d bytes", name, proto.Size(frontRequest),
+			client.RequestSize(targetSize, kernelSize, kernelNum))
+	}
+
+	// stop before contacting the server
+	if *DryRun {
+		clog.Printf("%s -> DRY RUN, built %d bytes", name, proto.Size(frontRequest))
+		return
+	}
+
+	// keep the failed requests, to send them again after the run
+	if *RetryFailed && !warmup {
+		defer func() {
+			if err != nil && rootCtx.Err() == nil {
+				recordFailed(failedRequest{id, name, requestID, frontRequest, target, err})
+			}
+		}()
+	}
+
+	// the span covers the calls and the checks of the results
+	ctx, span := tracer.Start(rootCtx, "ConvolutionalLayer", trace.WithAttributes(
+		attribute.Int("sdcc.request_id", id),
+		attribute.Bool("sdcc.warmup", warmup),
+		attribute.Int("sdcc.target_size", targetSize),
+		attribute.Int("sdcc.kernel_num", kernelNum),
+		attribute.Int("sdcc.kernel_size", kernelSize)))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(otelcodes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	// contact the server, an attempt at a time on the connections in turn
+	var r *pb.ConvolutionalLayerFrontReply
+	c, attempts := newFrontClient(clog, name, roundRobinFront{}, *MaxRetries)
+	callStart := time.Now()
+	if r, _, err = c.Send(ctx, requestID, frontRequest); err != nil {
+		logUnsuccessful(clog, name, err)
+		if errors.Is(err, client.ErrTooLarge) {
+			err = clientError{err}
+		}
+		return
+	}
+	cs := lastAttempts(attempts)
+	span.SetAttributes(attribute.Int("sdcc.result_count", len(r.GetResult())))
+	if *PrintSizes {
+		clog.Printf("%s -> Reply size: %d bytes, estimated: %d bytes", name, proto.Size(r),
+			client.ReplySize(targetSize, kernelSize, kernelNum, avgPoolSize))
+	}
+
+	latency := cs.latency
+	clog.Debugf("%s -> Timing. Generation: %d ms, Encoding: %.2f ms, Decoding: %.2f ms, Calls with retries: %d ms, RPC of the last attempts: %.2f ms",
+		name, buildTime.Milliseconds(), ms(cs.encode), ms(cs.decode), time.Since(callStart).Milliseconds(), ms(latency))
+
+	if err = checkResults(clog, name, id, target, frontRequest, r.GetResult()); err != nil {
+		return
+	}
+	if compareClient != nil {
+		if err = compareRun(ctx, clog, name, requestID, frontRequest, r.GetResult()); err != nil {
+			return
+		}
+	}
+
+	// only measured requests feed the statistics
+	if !warmup && (*PrintChecksum || *ExpectChecksum != "") {
+		recordChecksum(id, r.GetResult())
+	}
+	rec.PayloadSize = cs.sent
+	rec.BytesReceived = cs.received
+	rec.ServerID = r.GetID()
+	rec.Latency = latency
+	rec.Connect = cs.connect
+	rec.Call = cs.call
+	rec.Results = len(r.GetResult())
+
+	// print the result
+	clog.with("latency_ms", ms(latency)).Printf("%s -> Response: (#%d) in %d ms, Results: %d",
+		name,
+		r.GetID(),
+		latency.Milliseconds(),
+		len(r.GetResult()))
+	if *Verbose {
+		clog.Printf("%s -> Latency breakdown. Connection: %.2f ms, Call: %.2f ms", name, ms(cs.connect), ms(cs.call))
+	}
+
+	// only the first ResultLimit results are output, the server sending all of them
+	outputs := r.GetResult()
+	if *ResultLimit > 0 && len(outputs) > *ResultLimit {
+		outputs = outputs[:*ResultLimit]
+		clog.Printf("%s -> Keeping %d of the %d results received, as ResultLimit", name, len(outputs), len(r.GetResult()))
+	}
+
+	// a scalar per result, for the users that only validate a statistic
+	if *Reduce != "" {
+		for index, result := range outputs {
+			clog.with("result", index).Printf("%s -> Result %d %s: %g", name, index, *Reduce, reduceMatrix(utils.ProtoToMatrix(result), *Reduce))
+		}
+	}
+
+	// save the results
+	if *ResultImageDir != "" && !warmup {
+		if err := writeResultImages(*ResultImageDir, id, outputs); err != nil {
+			clog.Errorf("%s -> Could not write result images. More:\n%v", name, err)
+		}
+	}
+
+	if *ResultDir != "" && !warmup {
+		if err := writeResultCSVs(*ResultDir, id, outputs); err != nil {
+			clog.Errorf("%s -> Could not write result CSV files. More:\n%v", name, err)
+		}
+	}
+
+	// print the result
+	if *Verbose {
+		prettyPrint("Target", target, *PrintPrecision, *PrintMax)
+		kernels := frontRequest.Kernel
+		if *ResultLimit > 0 {
+			kernels = kernels[:min(len(kernels), *ResultLimit)]
+		}
+		for _, kernel := range kernels {
+			prettyPrint("Kernel", utils.ProtoToMatrix(kernel), *PrintPrecision, *PrintMax)
+		}
+		// the reductions are logged instead
+		if *Reduce == "" {
+			for _, result := range outputs {
+				prettyPrint("Result", utils.ProtoToMatrix(result), *PrintPrecision, *PrintMax)
+			}
+		}
+	}
+}
+
+// generateRequest builds the request id from the input files or, for the matrices they do not give, as selected by Fill
+func generateRequest(id int, targetSize int, kernelNum int, kernelSize int, avgPoolSize int, useKernels bool, useSigmoid bool) (*pb.ConvolutionalLayerFrontRequest, [][]float32, error) {
+	// each request has its own generator, so that its matrices depend only on the seed and its id
+	rng := rand.New(rand.NewSource(seed + int64(id)))
 	frontRequest := &pb.ConvolutionalLayerFrontRequest{}
 
 	// Set the target (input) matrix
 	var target [][]float32
-	if *ManualValues {
-		target = utils.ManualInputMatrix("target", targetSize)
+	var err error
+	if targetMatrix != nil {
+		target = targetMatrix
+	} else if target, err = fillMatrix(rng, *Fill, "target", targetSize); err != nil {
+		return nil, nil, err
 	} else {
-		target = utils.GenerateMatrix(targetSize, targetSize, *RandomValues, 1)
+		clampMatrix(target, valueMin, valueMax)
 	}
 	frontRequest.Target = utils.MatrixToProto(target)
 
 	// Set the kernels
 	for i := 0; i < kernelNum; i++ {
-		if *ManualValues {
-			frontRequest.Kernel = append(frontRequest.Kernel, utils.MatrixToProto(utils.ManualInputMatrix(fmt.Sprintf("kernel %d", i), kernelSize)))
+		if kernelMatrices != nil {
+			frontRequest.Kernel = append(frontRequest.Kernel, utils.MatrixToProto(kernelMatrices[i]))
 		} else {
-			frontRequest.Kernel = append(frontRequest.Kernel, utils.MatrixToProto(utils.GenerateMatrix(kernelSize, kernelSize, *RandomValues, 1)))
+			var kernel [][]float32
+			if *Fill == "random" {
+				kernel = distributedMatrix(rng, kernelSize, *KernelDist, kernelMean, kernelStdDev)
+			} else if kernel, err = fillMatrix(rng, *Fill, fmt.Sprintf("kernel %d", i), kernelSize); err != nil {
+				return nil, nil, err
+			}
+			clampMatrix(kernel, valueMin, valueMax)
+			frontRequest.Kernel = append(frontRequest.Kernel, utils.MatrixToProto(kernel))
 		}
 	}
 
@@ -117,82 +1131,490 @@ func convolutionalRun() {
 	frontRequest.AvgPoolSize = int32(avgPoolSize)
 	frontRequest.UseKernels = useKernels
 	frontRequest.UseSigmoid = useSigmoid
+	return frontRequest, target, nil
+}
 
-	// create the context
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+// roundRobinFront sends every call with the next client of the front service,
+// so that the attempts of a request are spread across the connections as well
+type roundRobinFront struct{}
 
-	// time the call
-	startTime := time.Now()
+func (roundRobinFront) ConvolutionalLayer(ctx context.Context, in *pb.ConvolutionalLayerFrontRequest, opts ...grpc.CallOption) (*pb.ConvolutionalLayerFrontReply, error) {
+	return frontClient().ConvolutionalLayer(ctx, in, opts...)
+}
 
-	// contact the server
-	r, err := c.ConvolutionalLayer(ctx, frontRequest)
+// newFrontClient returns a Client sending the request named name with front, retrying up to maxRetries times,
+// and the statistics of the last attempt of each of its sub-requests, by x-request-id, filled as the attempts are made.
+// Its hooks count the attempts, inject the failures, take the retries from the budget and report the slow attempts
+func newFrontClient(clog logger, name string, front pb.FrontClient, maxRetries int) (*client.Client, map[string]*callStats) {
+	attempts := map[string]*callStats{}
+	opts := frontOptions
+	opts.MaxRetries = maxRetries
+	opts.OnAttempt = func(ctx context.Context, id string) (context.Context, error) {
+		attemptCount.Add(1)
+		cs := &callStats{}
+		attempts[id] = cs
+		if injectFailureRate > 0 && rand.Float64() < injectFailureRate {
+			injectedCount.Add(1)
+			clog.Debugf("%s -> Failure injected, x-request-id: %s", name, id)
+			return ctx, status.Error(codes.Unavailable, "failure injected by InjectFailureRate")
+		}
+		return withCallStats(ctx, cs), nil
+	}
+	opts.OnRetry = func(id string, retry int, err error, delay time.Duration) bool {
+		if !takeRetry(clog) {
+			return false
+		}
+		clog.Printf("%s -> Attempt %d failed with %v, retrying in %d ms", name, retry+1, status.Code(err), delay.Milliseconds())
+		return true
+	}
+	opts.OnSlow = func(id string, elapsed time.Duration) {
+		slowCount.Add(1)
+		clog.Errorf("%s -> WARNING, slow request! x-request-id: %s, no reply after %d ms", name, id, elapsed.Milliseconds())
+	}
+	return client.NewWithFront(front, opts), attempts
+}
 
-	// check for errors
-	if err != nil {
-		if s, ok := status.FromError(err); ok {
-			log.Printf("[Client]: Request #%d -> Unsuccessful! %s: %v", id, s.Message(), s.Details())
-			wg.Done()
-			return
+// lastAttempts sums the statistics of the last attempts of the sub-requests
+func lastAttempts(attempts map[string]*callStats) *callStats {
+	cs := &callStats{}
+	for _, attempt := range attempts {
+		cs.add(attempt)
+	}
+	return cs
+}
+
+// clientError is a failure found by the client itself, as a request too large or malformed, or wrong results,
+// counted apart from the status codes of the front service
+type clientError struct {
+	err error
+}
+
+func (e clientError) Error() string {
+	return e.err.Error()
+}
+
+func (e clientError) Unwrap() error {
+	return e.err
+}
+
+// outcome returns the label counting a request that ended with err: its status code, OK without error,
+// or ClientError for a clientError
+func outcome(err error) string {
+	if errors.As(err, new(clientError)) {
+		return "ClientError"
+	}
+	return status.Code(err).String()
+}
+
+// logUnsuccessful logs the failure of the request named name
+func logUnsuccessful(clog logger, name string, err error) {
+	// non-status errors are converted to codes.Unknown
+	s := status.Convert(err)
+	clog.Errorf("%s -> Unsuccessful! %s: %v", name, s.Message(), s.Details())
+}
+
+// checkResults checks the shape of the results of request, and verifies them against target if enabled and sampled
+func checkResults(clog logger, name string, id int, target [][]float32, request *pb.ConvolutionalLayerFrontRequest, results []*pb.Matrix) error {
+	// check the shape of the results, a cheap subset of the verification
+	if err := client.CheckResultShape(request, results); err != nil {
+		clog.Errorf("%s -> WARNING, unexpected result shape! %v", name, err)
+		return clientError{err}
+	}
+
+	// a missing result points to a bug of the server, failing the request only with StrictResults
+	if err := client.CheckResultCount(request, results); err != nil {
+		clog.Errorf("%s -> WARNING, unexpected results! %v", name, err)
+		if *StrictResults {
+			return clientError{err}
 		}
 	}
 
-	// print the result
-	log.Printf("[Client]: Request #%d -> Response: (#%d) in %d ms, Results: %d",
-		id,
-		r.GetID(),
-		time.Since(startTime).Milliseconds(),
-		len(r.GetResult()))
+	// a result sent twice in place of another looks the same as different kernels yielding the same result,
+	// as on a target of zeros or a saturated sigmoid, so the duplicates are only reported
+	var duplicates []string
+	for _, pair := range client.DuplicatedResults(request, results) {
+		duplicates = append(duplicates, fmt.Sprintf("%d and %d", pair[0], pair[1]))
+	}
+	if len(duplicates) > 0 {
+		clog.Errorf("%s -> WARNING, identical results for different kernels: %s. Verify tells whether they are wrong.",
+			name, strings.Join(duplicates, ", "))
+	}
 
-	// print the result
-	if *Verbose {
-		utils.PrettyPrint("Target", target)
-		for _, kernel := range frontRequest.Kernel {
-			utils.PrettyPrint("Kernel", utils.ProtoToMatrix(kernel))
+	// compare the results with the local reference
+	if *Verify {
+		if !sampledForVerify(id) {
+			clog.Debugf("%s -> Not sampled for verification.", name)
+			return nil
 		}
-		for _, result := range r.GetResult() {
-			utils.PrettyPrint("Result", utils.ProtoToMatrix(result))
+		verifiedCount.Add(1)
+		verifyStart := time.Now()
+		if err := client.VerifyResults(target, request, results, tolerance); err != nil {
+			verifyFailedCount.Add(1)
+			clog.Errorf("%s -> Verification failed! %v", name, err)
+			return clientError{err}
 		}
+		clog.Printf("%s -> Verified %d results.", name, len(results))
+		clog.Debugf("%s -> Timing. Verification: %d ms", name, time.Since(verifyStart).Milliseconds())
+	}
+	return nil
+}
+
+// sampledForVerify tells whether the request id is among the VerifySample verified, drawn from Seed and the id only,
+// so that a run with the same Seed verifies the same requests, whatever the order of their replies
+func sampledForVerify(id int) bool {
+	if verifySample >= 1 {
+		return true
 	}
+	return idFraction("verify", id) < verifySample
+}
+
+// idFraction returns a fraction in [0, 1) drawn from Seed and the request id, a different one for each purpose,
+// so that the draws of a request do not depend on the others, nor on each other
+func idFraction(purpose string, id int) float64 {
+	h := fnv.New64a()
+	h.Write([]byte(purpose))
+	binary.Write(h, binary.LittleEndian, [2]int64{seed, int64(id)})
+	// the top 53 bits, as a float64 holds them exactly
+	return float64(h.Sum64()>>11) / (1 << 53)
+}
+
+// resetCounters forgets the requests sent so far
+func resetCounters() {
+	counterLock.Lock()
+	defer counterLock.Unlock()
+	counter.Store(0)
+	completedCount = 0
+	abortedCount = 0
+	failedCount = 0
+	builtCount = 0
+	resetLatencies()
+	resetRecords()
+	resetChecksums()
+	resetBatches()
+	verifiedCount.Store(0)
+	verifyFailedCount.Store(0)
+}
 
-	wg.Done()
+// waitRequests waits for the launched requests, bounding the wait once aborted
+func waitRequests() {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-rootCtx.Done():
+		select {
+		case <-done:
+		case <-time.After(shutdownGrace):
+			mainLog.Errorf("Requests still in flight after %v, giving up.", shutdownGrace)
+		}
+	}
 }
 
 func main() {
 	log.SetOutput(os.Stdout)
 
-	// parse the flags
-	flag.Parse()
+	// parse the flags, explicit flags override the environment, which overrides the config file
+	args, err := expandArgsFiles(os.Args[1:], 0)
+	if err != nil {
+		mainLog.Errorf("Could not read the arguments file. More:\n%v", err)
+		exit(1)
+	}
+	set, err := parseCommandLine(args)
+	if err != nil {
+		mainLog.Errorf("Invalid command line. More:\n%v", err)
+		exit(1)
+	}
+	if err := loadEnv(set); err != nil {
+		mainLog.Errorf("Invalid environment variable. More:\n%v", err)
+		exit(1)
+	}
+	utils.SetupFieldOptional(ConfigFile, "Config", "")
+	if *ConfigFile != "" {
+		if err := loadConfig(*ConfigFile, set); err != nil {
+			mainLog.Errorf("Could not load Config. More:\n%v", err)
+			exit(1)
+		}
+	}
 	setupFields()
 
+	// print the resolved parameters, or only them with PrintConfig
+	if *PrintConfig {
+		out, err := yaml.Marshal(effectiveConfig())
+		if err != nil {
+			mainLog.Errorf("Could not print the configuration. More:\n%v", err)
+			exit(1)
+		}
+		fmt.Print(string(out))
+		os.Exit(0)
+	}
+	mainLog.with("config", effectiveConfig()).Printf("Configuration: %s", configLine(effectiveConfig()))
+
+	// cancel all the requests on SIGINT or SIGTERM
+	rootCtx, rootCancel = context.WithCancel(context.Background())
+	defer rootCancel()
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigCh
+		mainLog.Printf("Received %v, aborting requests...", sig)
+		abortRun(fmt.Sprintf("received %v", sig))
+	}()
+
 	// Welcome message
 	requestCount, err := strconv.Atoi(*RequestCount)
 	if err != nil {
-		log.Printf("[Main]: RequestCount given is not a valid integer, reverting to default value: 1.")
+		mainLog.Errorf("RequestCount given is not a valid integer, reverting to default value: 1.")
 		requestCount = 1
 	}
-	log.Printf("[Main]: Welcome. Client will send %d requests in parallel.", requestCount)
+	// 0 means the default concurrency
+	concurrency := *Concurrency
+	if concurrency == 0 && runDuration > 0 {
+		concurrency = defaultConcurrency
+	} else if concurrency == 0 {
+		concurrency = max(min(requestCount, defaultConcurrency), 1)
+	}
+	// the batches replace Concurrency
+	if *BatchSize > 0 {
+		concurrency = *BatchSize
+	}
+	if runDuration > 0 {
+		mainLog.Printf("Welcome. Client will send requests for %v, at most %d in parallel.", runDuration, concurrency)
+	} else {
+		mainLog.Printf("Welcome. Client will send %d requests, at most %d in parallel.", requestCount, concurrency)
+	}
+	if *BatchSize > 0 {
+		mainLog.Printf("Sending batches of %d requests, %v apart.", *BatchSize, waitBetweenBatches)
+	}
+	for _, p := range profiles {
+		mainLog.Printf("Profile %s, weight %g. Target size: %d, Kernel size: %d, Kernel number: %d, Avg Pool Size: %d.",
+			p.name, p.weight, p.targetSize, p.kernelSize, p.kernelNum, p.avgPoolSize)
+	}
+	mainLog.Printf("Compression: %s. Seed: %d.", *Compression, seed)
 
-	// Set up a connection to the gRPC server
-	serverFullAddr := fmt.Sprintf("%s:%s", *FrontAddr, *FrontPort)
-	conn, err := grpc.Dial(serverFullAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		log.Fatalf("[Main]: Could not not connect. More:\n%v", err)
+	// set up tracing before connecting, the client handler propagates the spans
+	if *OtelEndpoint != "" {
+		if err := setupTracing(*OtelEndpoint); err != nil {
+			mainLog.Errorf("Could not set up tracing. More:\n%v", err)
+			exit(1)
+		}
+		mainLog.Printf("Exporting traces to %s.", *OtelEndpoint)
 	}
-	defer conn.Close()
 
-	// create the client object
-	c = pb.NewFrontClient(conn)
+	if *DryRun {
+		mainLog.Printf("Dry run, requests are built but not sent.")
+	} else {
+		if err := connect(); err != nil {
+			mainLog.Errorf("Could not set up the clients of the front service. More:\n%v", err)
+			exit(1)
+		}
+
+		// a wrong port or an incompatible server would fail every request with a less helpful error
+		if *Discover {
+			if err := discover(rootCtx); err != nil {
+				mainLog.Errorf("The front service cannot serve the requests, no request sent. More:\n%v", err)
+				exit(1)
+			}
+		}
 
-	for i := 0; i < requestCount; i++ {
-		wg.Add(1)
-		time.Sleep(time.Millisecond * time.Duration(100))
-		go convolutionalRun()
+		// a server that is down would fail every request with the same error
+		if *HealthCheck {
+			if err := checkHealth(rootCtx); err != nil {
+				mainLog.Errorf("The front service is not healthy, no request sent. More:\n%v", err)
+				exit(1)
+			}
+		}
 	}
 
-	// wait
-	log.Printf("[Main]: All requests sent. Waiting for responses...")
-	wg.Wait()
+	// open the outputs
+	if *CSVOut != "" {
+		if err := openCSV(*CSVOut); err != nil {
+			mainLog.Errorf("Could not open CSV output. More:\n%v", err)
+			exit(1)
+		}
+	}
+	if *HdrOut != "" {
+		if err := openHdr(*HdrOut); err != nil {
+			mainLog.Errorf("Could not open HdrOut. More:\n%v", err)
+			exit(1)
+		}
+	}
+	if *RecordRequests != "" {
+		if err := openRecord(*RecordRequests); err != nil {
+			mainLog.Errorf("Could not open the request log. More:\n%v", err)
+			exit(1)
+		}
+	}
+
+	for _, dir := range []string{*ResultImageDir, *ResultDir} {
+		if dir == "" {
+			continue
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			mainLog.Errorf("Could not create result directory %s. More:\n%v", dir, err)
+			exit(1)
+		}
+	}
+	if *MetricsAddr != "" {
+		startMetricsServer(*MetricsAddr)
+	}
+
+	// warmup requests validate the connection, but are not measured
+	if *Warmup > 0 && !*DryRun {
+		mainLog.Printf("Sending %d warmup requests...", *Warmup)
+		wd := newDispatcher(concurrency, launchRate, launchDelay, 0)
+		for i := 0; i < *Warmup; i++ {
+			if !wd.next(rootCtx) {
+				break
+			}
+			wd.launch(func() { convolutionalRun(true, nil) })
+		}
+		waitRequests()
+
+		counterLock.Lock()
+		failed := failedCount
+		counterLock.Unlock()
+		if rootCtx.Err() != nil {
+			mainLog.Errorf("Aborted by %s during warmup.", abortReason)
+			exit(1)
+		}
+		if failed > 0 {
+			mainLog.Errorf("%d of %d warmup requests failed. Terminating.", failed, *Warmup)
+			exit(1)
+		}
+		mainLog.Printf("Warmup completed. Sending measured requests...")
+		resetCounters()
+	}
+
+	// the sweep replaces the measured requests
+	if sweepSizes != nil && !*DryRun {
+		runSweep(concurrency, requestCount)
+	}
+
+	// the rate limiter replaces the launch delay
+	d := newDispatcher(concurrency, launchRate, launchDelay, rampUp)
+	if rampUp > 0 {
+		mainLog.Printf("Ramping up to %.2f requests per second over %v.", launchRate, rampUp)
+	} else if launchRate > 0 {
+		mainLog.Printf("Launching %.2f requests per second.", launchRate)
+	}
+
+	// in duration mode stop launching at the deadline, but let in-flight requests complete
+	dispatchCtx := rootCtx
+	if runDuration > 0 {
+		var cancel context.CancelFunc
+		dispatchCtx, cancel = context.WithTimeout(rootCtx, runDuration)
+		defer cancel()
+	}
+
+	// the bar needs a terminal, would break the JSON lines, and is redrawn on the line of the request logs on stdout
+	if *Progress {
+		// the matrices of Verbose are printed on stdout even with LogFile
+		requestLogs := *Verbose || (logLevel <= levelInfo && (*LogFile == "" || *LogTee))
+		if jsonLogs || !isTerminal(os.Stdout) {
+			mainLog.Printf("Progress bar disabled, stdout is not a terminal or the logs are JSON.")
+		} else if requestLogs {
+			mainLog.Printf("Progress bar disabled, the request logs are on stdout: set LogLevel=quiet, or LogFile without LogTee, and no Verbose.")
+		} else if runDuration > 0 {
+			bar = newProgressBar(0)
+		} else {
+			bar = newProgressBar(requestCount)
+		}
+	}
+
+	// stop launching requests once aborted
+	results, stopCollecting := collectResults(concurrency)
+	launchStart := time.Now()
+	launched := 0
+	if *BatchSize > 0 {
+		launched = runBatches(dispatchCtx, requestCount)
+	} else {
+		for i := 0; runDuration > 0 || i < requestCount; i++ {
+			if !d.next(dispatchCtx) {
+				break
+			}
+			d.launch(func() { convolutionalRun(false, results) })
+		}
+		launched = d.launched
+	}
+	if runDuration > 0 {
+		requestCount = launched
+	}
+	if elapsed := time.Since(launchStart).Seconds(); launched > 0 && elapsed > 0 {
+		mainLog.Printf("Launched %d requests at %.2f requests per second.", launched, float64(launched)/elapsed)
+	}
+
+	// wait, bounding the wait once aborted
+	mainLog.Printf("All requests sent. Waiting for responses...")
+	waitRequests()
+	stopCollecting()
+	if bar != nil {
+		bar.finish()
+	}
+	wallClock := time.Since(launchStart)
+	printSummary(wallClock)
+	printProfiles()
+	printBatches()
+	if compareClient != nil {
+		printComparison()
+	}
+	if *Histogram {
+		printHistogram(*HistogramBuckets)
+	}
+	if *PrintIDMap {
+		printIDMap()
+	}
+	if *JSONOut != "" {
+		if err := writeJSONSummary(*JSONOut, wallClock); err != nil {
+			mainLog.Errorf("Could not write JSON output. More:\n%v", err)
+		}
+	}
+	if err := writeHdrInterval("", launchStart); err != nil {
+		mainLog.Errorf("Could not write HdrOut. More:\n%v", err)
+	}
+
+	// the requests failed again decide the outcome of the run
+	stillFailing := -1
+	if *RetryFailed && rootCtx.Err() == nil {
+		stillFailing = resendFailed()
+	}
+	shutdown()
+
+	counterLock.Lock()
+	failed := failedCount
+	if stillFailing >= 0 {
+		failed = stillFailing
+	}
+	if rootCtx.Err() != nil {
+		mainLog.Errorf("Aborted by %s. Completed: %d, Failed: %d, Aborted: %d, In flight: %d, Not sent: %d.",
+			abortReason, completedCount, failedCount, abortedCount, launched-completedCount-abortedCount, requestCount-launched)
+		counterLock.Unlock()
+		exit(1)
+	}
+	counterLock.Unlock()
+
+	if runDuration > 0 {
+		elapsed := time.Since(launchStart)
+		mainLog.Summaryf("Sent %d requests in %v, throughput: %.2f requests per second.",
+			launched, elapsed.Round(time.Millisecond), float64(launched)/elapsed.Seconds())
+	}
+
+	if *PrintChecksum || *ExpectChecksum != "" {
+		checksum := runChecksum()
+		mainLog.Summaryf("Results checksum: %s", checksum)
+		if *ExpectChecksum != "" && !strings.EqualFold(checksum, *ExpectChecksum) {
+			mainLog.Errorf("Results checksum does not match the expected %s. Terminating.", *ExpectChecksum)
+			exit(1)
+		}
+	}
+
+	if failed > 0 {
+		mainLog.Errorf("%d of %d requests failed. Terminating.", failed, requestCount)
+		exit(1)
+	}
 
-	log.Printf("[Main]: All requests completed. Terminating. Goodbye.")
+	mainLog.Summaryf("All requests completed. Terminating. Goodbye.")
+	closeLogFile()
 }
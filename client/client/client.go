@@ -0,0 +1,299 @@
+// Package client sends convolutional layer requests to the Front service of SDCC.
+//
+// A Client sends a Request, split into sub-requests when it exceeds the message size, retrying the transient failures,
+// and returns its Result, optionally verified against a local reference:
+//
+//	c, err := client.New("localhost:55555", client.Options{Timeout: time.Minute, MaxRetries: 3})
+//	if err != nil {
+//		return err
+//	}
+//	defer c.Close()
+//	result, err := c.Run(ctx, client.Request{Target: target, Kernels: kernels, AvgPoolSize: 2})
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
+
+	pb "github.com/gmarseglia/SDCC-Common/proto"
+	"github.com/gmarseglia/SDCC-Common/utils"
+)
+
+// DefaultMaxMsgSize is the default limit of gRPC on the size of a message
+const DefaultMaxMsgSize = 4 * 1024 * 1024
+
+// Options configures how a Client sends the requests
+type Options struct {
+	// Timeout bounds each attempt of a sub-request, no timeout if 0
+	Timeout time.Duration
+	// MaxRetries bounds the retries of each sub-request on transient failures
+	MaxRetries int
+	// Backoff computes the delay between the retries, JitterBackoff from 100ms if nil
+	Backoff Backoff
+	// MaxMsgSize is the largest message sent or received, DefaultMaxMsgSize if 0
+	MaxMsgSize int
+	// SplitKernels splits the requests larger than MaxMsgSize by kernels, instead of failing them
+	SplitKernels bool
+	// Verify compares the results with the local reference, within Tolerance
+	Verify    bool
+	Tolerance float64
+	// CallOptions are added to every call, e.g. grpc.UseCompressor
+	CallOptions []grpc.CallOption
+
+	// Interceptor and StatsHandler observe the calls of the connection dialed by New, or by DialOptions
+	Interceptor  grpc.UnaryClientInterceptor
+	StatsHandler stats.Handler
+
+	// SoftTimeout calls OnSlow once an attempt has waited that long for its reply, without failing it
+	SoftTimeout time.Duration
+	OnSlow      func(id string, elapsed time.Duration)
+	// OnAttempt is called before each attempt with its context, and returns the one to call with.
+	// An error fails the attempt without calling, as a failure of the Front service would
+	OnAttempt func(ctx context.Context, id string) (context.Context, error)
+	// OnRetry is called before each retry, which is made only if it returns true
+	OnRetry func(id string, retry int, err error, delay time.Duration) bool
+}
+
+// Request is a convolutional layer: each kernel is applied to the target, then the sigmoid if enabled,
+// then the average pooling over windows of AvgPoolSize
+type Request struct {
+	// ID is sent as the x-request-id metadata, with the index of the sub-request appended when split,
+	// no metadata being sent when it is empty
+	ID          string
+	Target      [][]float32
+	Kernels     [][][]float32
+	AvgPoolSize int
+	UseSigmoid  bool
+}
+
+// Result is the outcome of a Request, a result per kernel, or the target pooled without kernels
+type Result struct {
+	ID      string
+	Results [][][]float32
+	// Latency sums the last attempts of the sub-requests
+	Latency time.Duration
+	// Retries counts the retries of all the sub-requests
+	Retries int
+}
+
+// Client sends requests to a Front service
+type Client struct {
+	conn  *grpc.ClientConn
+	front pb.FrontClient
+	opts  Options
+}
+
+// New returns a Client of the Front service at target, dialed with dialOpts, without TLS if none is given
+func New(target string, opts Options, dialOpts ...grpc.DialOption) (*Client, error) {
+	if len(dialOpts) == 0 {
+		dialOpts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	conn, err := grpc.NewClient(target, append(dialOpts, DialOptions(opts)...)...)
+	if err != nil {
+		return nil, err
+	}
+	c := NewWithFront(pb.NewFrontClient(conn), opts)
+	c.conn = conn
+	return c, nil
+}
+
+// DialOptions returns the options of a connection sending the requests of opts: the limits on the message size,
+// the Interceptor and the StatsHandler
+func DialOptions(opts Options) []grpc.DialOption {
+	maxMsgSize := opts.MaxMsgSize
+	if maxMsgSize == 0 {
+		maxMsgSize = DefaultMaxMsgSize
+	}
+	dialOpts := []grpc.DialOption{grpc.WithDefaultCallOptions(
+		grpc.MaxCallRecvMsgSize(maxMsgSize),
+		grpc.MaxCallSendMsgSize(maxMsgSize))}
+	if opts.Interceptor != nil {
+		dialOpts = append(dialOpts, grpc.WithUnaryInterceptor(opts.Interceptor))
+	}
+	if opts.StatsHandler != nil {
+		dialOpts = append(dialOpts, grpc.WithStatsHandler(opts.StatsHandler))
+	}
+	return dialOpts
+}
+
+// NewWithFront returns a Client sending the requests with front, whose connection is managed by the caller
+func NewWithFront(front pb.FrontClient, opts Options) *Client {
+	if opts.MaxMsgSize == 0 {
+		opts.MaxMsgSize = DefaultMaxMsgSize
+	}
+	if opts.Backoff == nil {
+		opts.Backoff = JitterBackoff{Base: 100 * time.Millisecond}
+	}
+	return &Client{front: front, opts: opts}
+}
+
+// Close closes the connection opened by New
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+// BuildRequest checks req and converts it to the request of the proto
+func BuildRequest(req Request) (*pb.ConvolutionalLayerFrontRequest, error) {
+	if len(req.Target) == 0 {
+		return nil, errors.New("target is not a non-empty square matrix")
+	}
+	for i, row := range req.Target {
+		if len(row) != len(req.Target) {
+			return nil, fmt.Errorf("target has %d values in row %d, expected %d", len(row), i, len(req.Target))
+		}
+	}
+	if req.AvgPoolSize <= 0 {
+		return nil, fmt.Errorf("AvgPoolSize must be positive, got %d", req.AvgPoolSize)
+	}
+	kernelSize := 0
+	if len(req.Kernels) > 0 {
+		kernelSize = len(req.Kernels[0])
+	}
+	if err := ValidateParams(len(req.Target), kernelSize, len(req.Kernels) > 0); err != nil {
+		return nil, err
+	}
+
+	request := &pb.ConvolutionalLayerFrontRequest{
+		Target:      utils.MatrixToProto(req.Target),
+		AvgPoolSize: int32(req.AvgPoolSize),
+		UseKernels:  len(req.Kernels) > 0,
+		UseSigmoid:  req.UseSigmoid,
+	}
+	for _, kernel := range req.Kernels {
+		request.Kernel = append(request.Kernel, utils.MatrixToProto(kernel))
+	}
+	if err := CheckKernelShape(request.Kernel, kernelSize); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// Run sends req and returns its results, failing if the Front service does or the results are not as expected
+func (c *Client) Run(ctx context.Context, req Request) (Result, error) {
+	request, err := BuildRequest(req)
+	if err != nil {
+		return Result{ID: req.ID}, err
+	}
+	r, result, err := c.Send(ctx, req.ID, request)
+	if err != nil {
+		return result, err
+	}
+
+	results := r.GetResult()
+	if err := CheckResultShape(request, results); err != nil {
+		return result, err
+	}
+	if err := CheckResultCount(request, results); err != nil {
+		return result, err
+	}
+	if c.opts.Verify {
+		if err := VerifyResults(req.Target, request, results, c.opts.Tolerance); err != nil {
+			return result, err
+		}
+	}
+	for _, r := range results {
+		result.Results = append(result.Results, utils.ProtoToMatrix(r))
+	}
+	return result, nil
+}
+
+// Send sends request with the id, split into sub-requests when larger than MaxMsgSize if allowed, and returns the reply
+// merging their results, in the order of the kernels. The Result counts the latency and the retries, without the results,
+// which are not checked
+func (c *Client) Send(ctx context.Context, id string, request *pb.ConvolutionalLayerFrontRequest) (*pb.ConvolutionalLayerFrontReply, Result, error) {
+	result := Result{ID: id}
+
+	// too large requests are rejected, or split by kernels if allowed
+	targetSize, kernelNum := len(request.GetTarget().GetRows()), len(request.GetKernel())
+	kernelSize := 0
+	if kernelNum > 0 {
+		kernelSize = len(request.GetKernel()[0].GetRows())
+	}
+	chunkSize, err := KernelsPerCall(targetSize, kernelSize, kernelNum, int(request.GetAvgPoolSize()), c.opts.MaxMsgSize, c.opts.SplitKernels)
+	if err != nil {
+		return nil, result, err
+	}
+
+	// a sub-request at a time, each attempt has its own timeout
+	var r *pb.ConvolutionalLayerFrontReply
+	var results []*pb.Matrix
+	chunks := SplitRequest(request, chunkSize)
+	for i, chunk := range chunks {
+		chunkID := id
+		if len(chunks) > 1 && id != "" {
+			chunkID = fmt.Sprintf("%s.%d", id, i)
+		}
+		var latency time.Duration
+		r, latency, err = c.call(ctx, chunkID, chunk, &result.Retries)
+		if err != nil {
+			return nil, result, err
+		}
+		result.Latency += latency
+		results = append(results, r.GetResult()...)
+	}
+	if len(chunks) > 1 {
+		r = &pb.ConvolutionalLayerFrontReply{Result: results, ID: r.GetID()}
+	}
+	return r, result, nil
+}
+
+// call sends request with the id, retrying it on transient failures, and returns the reply and the latency of the last attempt
+func (c *Client) call(ctx context.Context, id string, request *pb.ConvolutionalLayerFrontRequest, retries *int) (*pb.ConvolutionalLayerFrontReply, time.Duration, error) {
+	attempt := func() (*pb.ConvolutionalLayerFrontReply, time.Duration, error) {
+		ctx := ctx
+		if c.opts.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, c.opts.Timeout)
+			defer cancel()
+		}
+		if id != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, "x-request-id", id)
+		}
+		// the remaining time, so that the server can shed the work that would expire anyway
+		if deadline, ok := ctx.Deadline(); ok {
+			ctx = metadata.AppendToOutgoingContext(ctx, "x-deadline-ms", strconv.FormatInt(time.Until(deadline).Milliseconds(), 10))
+		}
+
+		// past the soft timeout the attempt is only reported, it goes on until the timeout
+		start := time.Now()
+		if c.opts.SoftTimeout > 0 && c.opts.OnSlow != nil {
+			slow := time.AfterFunc(c.opts.SoftTimeout, func() { c.opts.OnSlow(id, time.Since(start)) })
+			defer slow.Stop()
+		}
+		if c.opts.OnAttempt != nil {
+			var err error
+			if ctx, err = c.opts.OnAttempt(ctx, id); err != nil {
+				return nil, 0, err
+			}
+		}
+		r, err := c.front.ConvolutionalLayer(ctx, request, c.opts.CallOptions...)
+		return r, time.Since(start), err
+	}
+
+	r, latency, err := attempt()
+	for retry := 0; err != nil && IsRetriable(err) && retry < c.opts.MaxRetries; retry++ {
+		delay := c.opts.Backoff.Delay(retry)
+		if c.opts.OnRetry != nil && !c.opts.OnRetry(id, retry, err, delay) {
+			break
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, 0, err
+		}
+		*retries++
+		r, latency, err = attempt()
+	}
+	return r, latency, err
+}
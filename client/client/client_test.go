@@ -0,0 +1,284 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/gmarseglia/SDCC-Common/proto"
+	"github.com/gmarseglia/SDCC-Common/utils"
+)
+
+// fakeFront computes the results locally, failing its first calls with the errors of fail
+type fakeFront struct {
+	lock sync.Mutex
+	fail []error
+	// ids are the x-request-id of the calls, in order
+	ids []string
+}
+
+func (f *fakeFront) ConvolutionalLayer(ctx context.Context, in *pb.ConvolutionalLayerFrontRequest, _ ...grpc.CallOption) (*pb.ConvolutionalLayerFrontReply, error) {
+	f.lock.Lock()
+	md, _ := metadata.FromOutgoingContext(ctx)
+	f.ids = append(f.ids, md.Get("x-request-id")...)
+	if len(f.fail) > 0 {
+		err := f.fail[0]
+		f.fail = f.fail[1:]
+		f.lock.Unlock()
+		return nil, err
+	}
+	f.lock.Unlock()
+	return referenceReply(in), nil
+}
+
+// frontFunc is a Front service replying with its function
+type frontFunc func(ctx context.Context, in *pb.ConvolutionalLayerFrontRequest) (*pb.ConvolutionalLayerFrontReply, error)
+
+func (f frontFunc) ConvolutionalLayer(ctx context.Context, in *pb.ConvolutionalLayerFrontRequest, _ ...grpc.CallOption) (*pb.ConvolutionalLayerFrontReply, error) {
+	return f(ctx, in)
+}
+
+// referenceReply returns the reply of a correct Front service to in
+func referenceReply(in *pb.ConvolutionalLayerFrontRequest) *pb.ConvolutionalLayerFrontReply {
+	reply := &pb.ConvolutionalLayerFrontReply{ID: 1}
+	target := utils.ProtoToMatrix(in.Target)
+	for _, kernel := range in.Kernel {
+		result := ReferenceLayer(target, utils.ProtoToMatrix(kernel), in.UseKernels, int(in.AvgPoolSize), in.UseSigmoid)
+		reply.Result = append(reply.Result, utils.MatrixToProto(toFloat32(result)))
+	}
+	return reply
+}
+
+func toFloat32(matrix [][]float64) [][]float32 {
+	result := make([][]float32, len(matrix))
+	for i, row := range matrix {
+		result[i] = make([]float32, len(row))
+		for j, value := range row {
+			result[i][j] = float32(value)
+		}
+	}
+	return result
+}
+
+// testRequest returns a request of kernelNum kernels of side 3 on a target of side 8
+func testRequest(kernelNum int) Request {
+	square := func(size int, value float32) [][]float32 {
+		m := make([][]float32, size)
+		for i := range m {
+			m[i] = make([]float32, size)
+			for j := range m[i] {
+				m[i][j] = value * float32(i*size+j)
+			}
+		}
+		return m
+	}
+	req := Request{ID: "req", Target: square(8, 0.01), AvgPoolSize: 2}
+	for k := 0; k < kernelNum; k++ {
+		req.Kernels = append(req.Kernels, square(3, float32(k+1)))
+	}
+	return req
+}
+
+func TestRunVerifiesTheResults(t *testing.T) {
+	front := &fakeFront{}
+	c := NewWithFront(front, Options{Verify: true, Tolerance: 1e-4})
+	result, err := c.Run(context.Background(), testRequest(3))
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(result.Results) != 3 || result.Retries != 0 || result.ID != "req" {
+		t.Errorf("got %d results, %d retries, ID %q, expected 3, 0, req", len(result.Results), result.Retries, result.ID)
+	}
+	if !reflect.DeepEqual(front.ids, []string{"req"}) {
+		t.Errorf("got x-request-id %v, expected [req]", front.ids)
+	}
+}
+
+func TestRunFailsWrongResults(t *testing.T) {
+	front := frontFunc(func(ctx context.Context, in *pb.ConvolutionalLayerFrontRequest) (*pb.ConvolutionalLayerFrontReply, error) {
+		reply := referenceReply(in)
+		reply.Result[0].Rows[0].Values[0] += 1
+		return reply, nil
+	})
+	c := NewWithFront(front, Options{Verify: true, Tolerance: 1e-4})
+	if _, err := c.Run(context.Background(), testRequest(2)); err == nil {
+		t.Error("Run succeeded with a wrong result")
+	}
+}
+
+func TestRunRetries(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "down")
+	tests := []struct {
+		name        string
+		fail        []error
+		maxRetries  int
+		wantCode    codes.Code
+		wantRetries int
+		wantCalls   int
+	}{
+		{"no failure", nil, 2, codes.OK, 0, 1},
+		{"transient failures", []error{unavailable, unavailable}, 2, codes.OK, 2, 3},
+		{"retries exhausted", []error{unavailable, unavailable, unavailable}, 2, codes.Unavailable, 2, 3},
+		{"not retriable", []error{status.Error(codes.InvalidArgument, "bad")}, 2, codes.InvalidArgument, 0, 1},
+		{"non-status error", []error{errors.New("broken")}, 2, codes.Unknown, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			front := &fakeFront{fail: tt.fail}
+			c := NewWithFront(front, Options{MaxRetries: tt.maxRetries, Backoff: ConstantBackoff{}})
+			result, err := c.Run(context.Background(), testRequest(1))
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("got %v, expected %v", err, tt.wantCode)
+			}
+			if result.Retries != tt.wantRetries || len(front.ids) != tt.wantCalls {
+				t.Errorf("got %d retries and %d calls, expected %d and %d", result.Retries, len(front.ids), tt.wantRetries, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestHooks(t *testing.T) {
+	front := &fakeFront{fail: []error{status.Error(codes.Unavailable, "down")}}
+	var attempts []string
+	var retries int
+	opts := Options{
+		MaxRetries: 3,
+		Backoff:    ConstantBackoff{},
+		OnAttempt: func(ctx context.Context, id string) (context.Context, error) {
+			attempts = append(attempts, id)
+			return ctx, nil
+		},
+		// refuse the retries
+		OnRetry: func(id string, retry int, err error, delay time.Duration) bool {
+			retries++
+			return false
+		},
+	}
+	_, err := NewWithFront(front, opts).Run(context.Background(), testRequest(1))
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("got %v, expected Unavailable", err)
+	}
+	if len(attempts) != 1 || retries != 1 || len(front.ids) != 1 {
+		t.Errorf("got %d attempts, %d retries asked, %d calls, expected 1 each", len(attempts), retries, len(front.ids))
+	}
+
+	// a failed OnAttempt fails the attempt without calling
+	front = &fakeFront{}
+	opts.OnAttempt = func(ctx context.Context, id string) (context.Context, error) {
+		return ctx, status.Error(codes.Unavailable, "injected")
+	}
+	if _, err := NewWithFront(front, opts).Run(context.Background(), testRequest(1)); status.Code(err) != codes.Unavailable || len(front.ids) != 0 {
+		t.Errorf("got %v after %d calls, expected Unavailable without calls", err, len(front.ids))
+	}
+}
+
+func TestRunSplitsLargeRequests(t *testing.T) {
+	req := testRequest(6)
+	limit := ExpectedSize(8, 3, 2, 2)
+
+	// rejected without SplitKernels
+	c := NewWithFront(&fakeFront{}, Options{MaxMsgSize: limit})
+	if _, err := c.Run(context.Background(), req); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("got %v, expected ErrTooLarge", err)
+	}
+
+	front := &fakeFront{}
+	c = NewWithFront(front, Options{MaxMsgSize: limit, SplitKernels: true, Verify: true, Tolerance: 1e-4})
+	result, err := c.Run(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(result.Results) != 6 {
+		t.Errorf("got %d results, expected 6", len(result.Results))
+	}
+	if want := []string{"req.0", "req.1", "req.2"}; !reflect.DeepEqual(front.ids, want) {
+		t.Errorf("got x-request-id %v, expected %v", front.ids, want)
+	}
+
+	// without an id, the sub-requests have none either
+	front = &fakeFront{}
+	c = NewWithFront(front, Options{MaxMsgSize: limit, SplitKernels: true})
+	req.ID = ""
+	if _, err := c.Run(context.Background(), req); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(front.ids) != 0 {
+		t.Errorf("got x-request-id %v, expected none", front.ids)
+	}
+}
+
+func TestRunRejectsInvalidRequests(t *testing.T) {
+	c := NewWithFront(&fakeFront{}, Options{})
+	invalid := map[string]Request{
+		"empty target":     {},
+		"no pooling":       {Target: testRequest(0).Target},
+		"kernel too large": {Target: [][]float32{{1}}, Kernels: testRequest(1).Kernels, AvgPoolSize: 1},
+	}
+	for name, req := range invalid {
+		if _, err := c.Run(context.Background(), req); err == nil {
+			t.Errorf("%s: Run succeeded", name)
+		}
+	}
+}
+
+// frontServer serves a fakeFront over gRPC
+type frontServer struct {
+	pb.UnimplementedFrontServer
+	front *fakeFront
+}
+
+func (s *frontServer) ConvolutionalLayer(ctx context.Context, in *pb.ConvolutionalLayerFrontRequest) (*pb.ConvolutionalLayerFrontReply, error) {
+	// the metadata received, as the fake reads the outgoing one
+	md, _ := metadata.FromIncomingContext(ctx)
+	return s.front.ConvolutionalLayer(metadata.NewOutgoingContext(ctx, md), in)
+}
+
+func TestNew(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	front := &fakeFront{}
+	s := grpc.NewServer()
+	pb.RegisterFrontServer(s, &frontServer{front: front})
+	go s.Serve(lis)
+	defer s.Stop()
+
+	var intercepted []string
+	opts := Options{
+		Timeout: 5 * time.Second,
+		Verify:  true, Tolerance: 1e-4,
+		Interceptor: func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			intercepted = append(intercepted, method)
+			return invoker(ctx, method, req, reply, cc, opts...)
+		},
+	}
+	c, err := New(lis.Addr().String(), opts)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer c.Close()
+
+	result, err := c.Run(context.Background(), testRequest(2))
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(result.Results) != 2 || result.Latency <= 0 {
+		t.Errorf("got %d results in %v, expected 2 in a positive latency", len(result.Results), result.Latency)
+	}
+	if len(intercepted) != 1 {
+		t.Errorf("got %d intercepted calls, expected 1", len(intercepted))
+	}
+	if !reflect.DeepEqual(front.ids, []string{"req"}) {
+		t.Errorf("got x-request-id %v, expected [req]", front.ids)
+	}
+}
@@ -0,0 +1,100 @@
+package client
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// IsRetriable reports whether a failed call may succeed if sent again
+func IsRetriable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	default:
+		return false
+	}
+}
+
+// Backoff computes the delay before each retry of a call
+type Backoff interface {
+	// Delay returns the delay before the given retry, starting from 0
+	Delay(retry int) time.Duration
+}
+
+// ConstantBackoff waits Base before every retry
+type ConstantBackoff struct {
+	Base time.Duration
+}
+
+// Delay returns Base
+func (b ConstantBackoff) Delay(retry int) time.Duration {
+	return max(b.Base, 0)
+}
+
+// ExponentialBackoff doubles the delay from Base at every retry, up to Max if positive
+type ExponentialBackoff struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+// Delay returns Base doubled retry times, at most Max, a negative retry counting as the first one
+func (b ExponentialBackoff) Delay(retry int) time.Duration {
+	if b.Base <= 0 {
+		return 0
+	}
+	retry = min(max(retry, 0), 30)
+	d := b.Base << retry
+	// past the range of a Duration the delay is as long as allowed
+	if d>>retry != b.Base {
+		d = math.MaxInt64
+	}
+	if b.Max > 0 {
+		d = min(d, b.Max)
+	}
+	return d
+}
+
+// JitterBackoff doubles the delay from Base at every retry, up to Max if positive, randomizing its second half,
+// so that the clients failing together do not retry together
+type JitterBackoff struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+// Delay returns Base doubled retry times, at most Max, of which half is random
+func (b JitterBackoff) Delay(retry int) time.Duration {
+	d := ExponentialBackoff(b).Delay(retry)
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// BackoffPolicies are the names accepted by NewBackoff
+var BackoffPolicies = []string{"constant", "exponential", "exponential-jitter"}
+
+// NewBackoff returns the Backoff named by policy, one of BackoffPolicies, from base up to maxDelay, without a limit if 0
+func NewBackoff(policy string, base time.Duration, maxDelay time.Duration) (Backoff, error) {
+	switch policy {
+	case "constant":
+		return ConstantBackoff{Base: base}, nil
+	case "exponential":
+		return ExponentialBackoff{Base: base, Max: maxDelay}, nil
+	case "exponential-jitter":
+		return JitterBackoff{Base: base, Max: maxDelay}, nil
+	}
+	return nil, fmt.Errorf("unknown backoff policy %q, must be one of: %s", policy, strings.Join(BackoffPolicies, ", "))
+}
+
+// IsFatal reports whether a failed call means a misconfiguration, so that every other call would fail as well
+func IsFatal(err error) bool {
+	switch status.Code(err) {
+	case codes.InvalidArgument, codes.Unauthenticated, codes.PermissionDenied, codes.Unimplemented:
+		return true
+	default:
+		return false
+	}
+}
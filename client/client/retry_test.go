@@ -0,0 +1,95 @@
+package client
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	const ms = time.Millisecond
+	tests := []struct {
+		name    string
+		backoff Backoff
+		retries []int
+		want    []time.Duration
+	}{
+		{"constant", ConstantBackoff{Base: 100 * ms}, []int{-1, 0, 1, 5}, []time.Duration{100 * ms, 100 * ms, 100 * ms, 100 * ms}},
+		{"constant negative base", ConstantBackoff{Base: -ms}, []int{0}, []time.Duration{0}},
+		{"exponential", ExponentialBackoff{Base: 100 * ms}, []int{0, 1, 2, 3}, []time.Duration{100 * ms, 200 * ms, 400 * ms, 800 * ms}},
+		{"exponential negative retry", ExponentialBackoff{Base: 100 * ms}, []int{-1, -100}, []time.Duration{100 * ms, 100 * ms}},
+		{"exponential capped", ExponentialBackoff{Base: 100 * ms, Max: 300 * ms}, []int{0, 1, 2, 10, 1000}, []time.Duration{100 * ms, 200 * ms, 300 * ms, 300 * ms, 300 * ms}},
+		{"exponential overflow", ExponentialBackoff{Base: time.Hour}, []int{30, 1000}, []time.Duration{math.MaxInt64, math.MaxInt64}},
+		{"exponential overflow capped", ExponentialBackoff{Base: time.Hour, Max: time.Minute}, []int{30}, []time.Duration{time.Minute}},
+		{"exponential zero base", ExponentialBackoff{}, []int{0, 5}, []time.Duration{0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, retry := range tt.retries {
+				if got := tt.backoff.Delay(retry); got != tt.want[i] {
+					t.Errorf("Delay(%d) = %v, expected %v", retry, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestJitterBackoffDelay(t *testing.T) {
+	const ms = time.Millisecond
+	tests := []struct {
+		name    string
+		backoff JitterBackoff
+		retry   int
+		// the delay is between the half of the exponential delay and the whole
+		exponential time.Duration
+	}{
+		{"first retry", JitterBackoff{Base: 100 * ms}, 0, 100 * ms},
+		{"third retry", JitterBackoff{Base: 100 * ms}, 2, 400 * ms},
+		{"negative retry", JitterBackoff{Base: 100 * ms}, -3, 100 * ms},
+		{"capped", JitterBackoff{Base: 100 * ms, Max: 300 * ms}, 5, 300 * ms},
+		{"zero base", JitterBackoff{}, 3, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				if got := tt.backoff.Delay(tt.retry); got < tt.exponential/2 || got > tt.exponential {
+					t.Fatalf("Delay(%d) = %v, expected between %v and %v", tt.retry, got, tt.exponential/2, tt.exponential)
+				}
+			}
+		})
+	}
+}
+
+func TestNewBackoff(t *testing.T) {
+	for _, policy := range BackoffPolicies {
+		b, err := NewBackoff(policy, 100*time.Millisecond, time.Second)
+		if err != nil {
+			t.Errorf("NewBackoff(%q) failed: %v", policy, err)
+			continue
+		}
+		if d := b.Delay(10); d > time.Second {
+			t.Errorf("%s: Delay(10) = %v, above the maximum", policy, d)
+		}
+	}
+	if _, err := NewBackoff("linear", time.Second, 0); err == nil {
+		t.Error("NewBackoff accepted an unknown policy")
+	}
+}
+
+func TestIsRetriable(t *testing.T) {
+	tests := map[codes.Code]bool{
+		codes.Unavailable:      true,
+		codes.DeadlineExceeded: true,
+		codes.InvalidArgument:  false,
+		codes.Internal:         false,
+		codes.Unknown:          false,
+	}
+	for code, want := range tests {
+		if got := IsRetriable(status.Error(code, "")); got != want {
+			t.Errorf("IsRetriable(%v) = %v, expected %v", code, got, want)
+		}
+	}
+}
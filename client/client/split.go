@@ -0,0 +1,98 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	pb "github.com/gmarseglia/SDCC-Common/proto"
+)
+
+// ExpectedSize estimates the size in bytes of the largest message of a request, the request or its reply,
+// kernels being used when kernelSize is positive. An avgPoolSize of 1 leaves the results unpooled
+func ExpectedSize(targetSize int, kernelSize int, kernelNum int, avgPoolSize int) int {
+	return max(RequestSize(targetSize, kernelSize, kernelNum), ReplySize(targetSize, kernelSize, kernelNum, avgPoolSize))
+}
+
+// RequestSize estimates the size in bytes of a request, 4 bytes per value of the target and the kernels
+func RequestSize(targetSize int, kernelSize int, kernelNum int) int {
+	return (targetSize * targetSize * 4) + (kernelSize*kernelSize*kernelNum)*4
+}
+
+// ReplySize estimates the size in bytes of the reply to a request, 4 bytes per value of its results
+func ReplySize(targetSize int, kernelSize int, kernelNum int, avgPoolSize int) int {
+	resultSize := ResultSize(targetSize, kernelSize, kernelSize > 0, avgPoolSize)
+	return resultSize * resultSize * kernelNum * 4
+}
+
+// KernelsPerChunk returns the most kernels a sub-request can carry within limit, 0 if not even one fits
+func KernelsPerChunk(targetSize int, kernelSize int, kernelNum int, avgPoolSize int, limit int) int {
+	for n := kernelNum; n > 0; n-- {
+		if ExpectedSize(targetSize, kernelSize, n, avgPoolSize) <= limit {
+			return n
+		}
+	}
+	return 0
+}
+
+// ErrTooLarge is returned for the requests larger than the message size, that cannot be split to fit
+var ErrTooLarge = errors.New("request too large")
+
+// KernelsPerCall returns the most kernels sent by a call within maxMsgSize, kernelNum if the request fits as a whole.
+// A larger request fails with ErrTooLarge, unless split allows sending it by fewer kernels at a time
+func KernelsPerCall(targetSize int, kernelSize int, kernelNum int, avgPoolSize int, maxMsgSize int, split bool) (int, error) {
+	if avgPoolSize <= 0 {
+		return 0, fmt.Errorf("AvgPoolSize must be positive, got %d", avgPoolSize)
+	}
+	if ExpectedSize(targetSize, kernelSize, kernelNum, avgPoolSize) <= maxMsgSize {
+		return kernelNum, nil
+	}
+	if split {
+		if n := KernelsPerChunk(targetSize, kernelSize, kernelNum, avgPoolSize, maxMsgSize); n > 0 {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("%w, larger than %d bytes, try %s", ErrTooLarge, maxMsgSize,
+		SuggestFittingParams(targetSize, kernelSize, kernelNum, avgPoolSize, maxMsgSize))
+}
+
+// SplitRequest returns sub-requests with at most chunkSize kernels each, in the order of the kernels
+func SplitRequest(request *pb.ConvolutionalLayerFrontRequest, chunkSize int) []*pb.ConvolutionalLayerFrontRequest {
+	if chunkSize <= 0 || len(request.Kernel) <= chunkSize {
+		return []*pb.ConvolutionalLayerFrontRequest{request}
+	}
+
+	var chunks []*pb.ConvolutionalLayerFrontRequest
+	for start := 0; start < len(request.Kernel); start += chunkSize {
+		end := min(start+chunkSize, len(request.Kernel))
+		chunks = append(chunks, &pb.ConvolutionalLayerFrontRequest{
+			Target:      request.Target,
+			Kernel:      request.Kernel[start:end],
+			AvgPoolSize: request.AvgPoolSize,
+			UseKernels:  request.UseKernels,
+			UseSigmoid:  request.UseSigmoid,
+		})
+	}
+	return chunks
+}
+
+// SuggestFittingParams describes the largest KernelNum and TargetSize that keep a request within limit
+func SuggestFittingParams(targetSize int, kernelSize int, kernelNum int, avgPoolSize int, limit int) string {
+	var hints []string
+	if n := KernelsPerChunk(targetSize, kernelSize, kernelNum, avgPoolSize, limit); n > 0 {
+		hints = append(hints, fmt.Sprintf("KernelNum at most %d (or SplitKernels)", n))
+	}
+
+	// the target cannot be smaller than the kernels
+	for t := targetSize - 1; t >= max(kernelSize, 1); t-- {
+		if ExpectedSize(t, kernelSize, kernelNum, avgPoolSize) <= limit {
+			hints = append(hints, fmt.Sprintf("TargetSize at most %d", t))
+			break
+		}
+	}
+
+	if len(hints) == 0 {
+		return "raising MaxMsgSize, no KernelNum or TargetSize fits"
+	}
+	return strings.Join(hints, ", or ")
+}
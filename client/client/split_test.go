@@ -0,0 +1,33 @@
+package client
+
+import (
+	"context"
+	"testing"
+)
+
+func TestZeroAvgPoolSize(t *testing.T) {
+	if got := ResultSize(8, 3, true, 0); got != 0 {
+		t.Errorf("ResultSize = %d, expected 0", got)
+	}
+	if got := ExpectedSize(8, 3, 2, 0); got != RequestSize(8, 3, 2) {
+		t.Errorf("ExpectedSize = %d, expected the size of the request, %d", got, RequestSize(8, 3, 2))
+	}
+	if _, err := KernelsPerCall(8, 3, 2, 0, 1<<20, true); err == nil {
+		t.Error("KernelsPerCall succeeded")
+	}
+
+	// a request built elsewhere reaches Send without the checks of Run
+	front := &fakeFront{}
+	request, err := BuildRequest(testRequest(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.AvgPoolSize = 0
+	c := NewWithFront(front, Options{MaxMsgSize: 1 << 20})
+	if _, _, err := c.Send(context.Background(), "req", request); err == nil {
+		t.Error("Send succeeded")
+	}
+	if len(front.ids) != 0 {
+		t.Errorf("the front service got %d calls, expected none", len(front.ids))
+	}
+}
@@ -0,0 +1,255 @@
+package client
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/gmarseglia/SDCC-Common/proto"
+	"github.com/gmarseglia/SDCC-Common/utils"
+)
+
+// MaxReportedMismatches bounds the indices listed by a failed verification
+const MaxReportedMismatches = 5
+
+// ResultSize returns the side of a result: the valid convolution, when kernels are used,
+// pooled over windows of poolSize, the last window being partial. A poolSize below 1 is invalid and yields 0
+func ResultSize(targetSize int, kernelSize int, useKernels bool, poolSize int) int {
+	if poolSize <= 0 {
+		return 0
+	}
+	size := targetSize
+	if useKernels {
+		size = targetSize - kernelSize + 1
+	}
+	return (size + poolSize - 1) / poolSize
+}
+
+// ValidateParams checks that the convolution of a request is well defined
+func ValidateParams(targetSize int, kernelSize int, useKernels bool) error {
+	if !useKernels {
+		return nil
+	}
+	if kernelSize < 1 {
+		return fmt.Errorf("kernel size %d, expected at least 1", kernelSize)
+	}
+	// a kernel as large as the target is valid and yields a 1x1 result
+	if kernelSize > targetSize {
+		return fmt.Errorf("kernel size %d exceeds target size %d", kernelSize, targetSize)
+	}
+	return nil
+}
+
+// CheckKernelShape checks that every kernel is a square of side size, before sending them
+func CheckKernelShape(kernels []*pb.Matrix, size int) error {
+	for index, kernel := range kernels {
+		if len(kernel.Rows) != size {
+			return fmt.Errorf("kernel %d has %d rows, expected %d", index, len(kernel.Rows), size)
+		}
+		for i, row := range kernel.Rows {
+			if len(row.Values) != size {
+				return fmt.Errorf("kernel %d has %d values in row %d, expected %d", index, len(row.Values), i, size)
+			}
+		}
+	}
+	return nil
+}
+
+// CheckResultShape checks that every result is a square of the side given by ResultSize,
+// the sigmoid does not change the shape
+func CheckResultShape(request *pb.ConvolutionalLayerFrontRequest, results []*pb.Matrix) error {
+	kernelSize := 0
+	if len(request.Kernel) > 0 {
+		kernelSize = len(request.Kernel[0].Rows)
+	}
+	size := ResultSize(len(request.Target.Rows), kernelSize, request.UseKernels, int(request.AvgPoolSize))
+	for index, result := range results {
+		if len(result.Rows) != size {
+			return fmt.Errorf("result %d has %d rows, expected %d", index, len(result.Rows), size)
+		}
+		for i, row := range result.Rows {
+			if len(row.Values) != size {
+				return fmt.Errorf("result %d has %d values in row %d, expected %d", index, len(row.Values), i, size)
+			}
+		}
+	}
+	return nil
+}
+
+// CheckResultCount checks that there is a result per kernel of request
+func CheckResultCount(request *pb.ConvolutionalLayerFrontRequest, results []*pb.Matrix) error {
+	if len(results) != len(request.Kernel) {
+		return fmt.Errorf("expected %d results, got %d", len(request.Kernel), len(results))
+	}
+	return nil
+}
+
+// matrixHash hashes the values of matrix, so that identical matrices are found without comparing every pair
+func matrixHash(matrix *pb.Matrix) uint64 {
+	h := fnv.New64a()
+	var buf [4]byte
+	for _, row := range matrix.GetRows() {
+		for _, value := range row.GetValues() {
+			binary.LittleEndian.PutUint32(buf[:], math.Float32bits(value))
+			h.Write(buf[:])
+		}
+		// rows of different lengths with the same values hash apart
+		h.Write([]byte{0xff})
+	}
+	return h.Sum64()
+}
+
+// DuplicatedResults returns the pairs of identical results whose kernels differ, the first result first,
+// the results of a server that sent a result twice in place of another
+func DuplicatedResults(request *pb.ConvolutionalLayerFrontRequest, results []*pb.Matrix) [][2]int {
+	var pairs [][2]int
+	first := map[uint64]int{}
+	for index, result := range results {
+		h := matrixHash(result)
+		prev, seen := first[h]
+		if !seen {
+			first[h] = index
+			continue
+		}
+		if !proto.Equal(results[prev], result) || index >= len(request.Kernel) {
+			continue
+		}
+		if !proto.Equal(request.Kernel[prev], request.Kernel[index]) {
+			pairs = append(pairs, [2]int{prev, index})
+		}
+	}
+	return pairs
+}
+
+// ReferenceLayer computes a result locally: the valid cross-correlation of target and kernel,
+// the optional sigmoid, then the average pooling
+func ReferenceLayer(target [][]float32, kernel [][]float32, useKernels bool, poolSize int, useSigmoid bool) [][]float64 {
+	// convolution
+	size := len(target)
+	kernelSize := 0
+	if useKernels {
+		kernelSize = len(kernel)
+		size = len(target) - kernelSize + 1
+	}
+	conv := make([][]float64, size)
+	for i := range conv {
+		conv[i] = make([]float64, size)
+		for j := range conv[i] {
+			if !useKernels {
+				conv[i][j] = float64(target[i][j])
+				continue
+			}
+			var sum float64
+			for ki := 0; ki < kernelSize; ki++ {
+				for kj := 0; kj < kernelSize; kj++ {
+					sum += float64(target[i+ki][j+kj]) * float64(kernel[ki][kj])
+				}
+			}
+			conv[i][j] = sum
+		}
+	}
+
+	// activation
+	if useSigmoid {
+		for i := range conv {
+			for j := range conv[i] {
+				conv[i][j] = 1 / (1 + math.Exp(-conv[i][j]))
+			}
+		}
+	}
+
+	// pooling
+	pooledSize := ResultSize(len(target), kernelSize, useKernels, poolSize)
+	pooled := make([][]float64, pooledSize)
+	for i := range pooled {
+		pooled[i] = make([]float64, pooledSize)
+		for j := range pooled[i] {
+			var sum float64
+			var count int
+			for pi := i * poolSize; pi < min((i+1)*poolSize, size); pi++ {
+				for pj := j * poolSize; pj < min((j+1)*poolSize, size); pj++ {
+					sum += conv[pi][pj]
+					count++
+				}
+			}
+			pooled[i][j] = sum / float64(count)
+		}
+	}
+	return pooled
+}
+
+// CompareMatrices returns the maximum absolute difference between expected and actual
+// and the indices where it exceeds tol
+func CompareMatrices(expected [][]float64, actual [][]float32, tol float64) (float64, [][2]int, error) {
+	if len(actual) != len(expected) {
+		return 0, nil, fmt.Errorf("expected %d rows, got %d", len(expected), len(actual))
+	}
+	var maxDiff float64
+	var mismatches [][2]int
+	for i := range expected {
+		if len(actual[i]) != len(expected[i]) {
+			return 0, nil, fmt.Errorf("expected %d values in row %d, got %d", len(expected[i]), i, len(actual[i]))
+		}
+		for j := range expected[i] {
+			diff := math.Abs(expected[i][j] - float64(actual[i][j]))
+			maxDiff = math.Max(maxDiff, diff)
+			if diff > tol || math.IsNaN(diff) {
+				mismatches = append(mismatches, [2]int{i, j})
+			}
+		}
+	}
+	return maxDiff, mismatches, nil
+}
+
+// VerifyResults compares each result of request with the local reference, within tolerance
+func VerifyResults(target [][]float32, request *pb.ConvolutionalLayerFrontRequest, results []*pb.Matrix, tolerance float64) error {
+	if err := CheckResultCount(request, results); err != nil {
+		return err
+	}
+	for index, result := range results {
+		expected := ReferenceLayer(target, utils.ProtoToMatrix(request.Kernel[index]),
+			request.UseKernels, int(request.AvgPoolSize), request.UseSigmoid)
+		maxDiff, mismatches, err := CompareMatrices(expected, utils.ProtoToMatrix(result), tolerance)
+		if err != nil {
+			return fmt.Errorf("result %d: %w", index, err)
+		}
+		if len(mismatches) > 0 {
+			return fmt.Errorf("result %d: %d values differ by more than %g, max difference %g, at %v",
+				index, len(mismatches), tolerance, maxDiff, mismatches[:min(len(mismatches), MaxReportedMismatches)])
+		}
+	}
+	return nil
+}
+
+// CompareResults compares each result of a front service with the result of another one, within tolerance
+func CompareResults(results []*pb.Matrix, compared []*pb.Matrix, tolerance float64) error {
+	if len(compared) != len(results) {
+		return fmt.Errorf("expected %d results, got %d", len(results), len(compared))
+	}
+	for index, result := range results {
+		maxDiff, mismatches, err := CompareMatrices(toFloat64(utils.ProtoToMatrix(result)), utils.ProtoToMatrix(compared[index]), tolerance)
+		if err != nil {
+			return fmt.Errorf("result %d: %w", index, err)
+		}
+		if len(mismatches) > 0 {
+			return fmt.Errorf("result %d: %d values differ by more than %g, max difference %g, at %v",
+				index, len(mismatches), tolerance, maxDiff, mismatches[:min(len(mismatches), MaxReportedMismatches)])
+		}
+	}
+	return nil
+}
+
+// toFloat64 converts matrix to float64, as CompareMatrices expects
+func toFloat64(matrix [][]float32) [][]float64 {
+	result := make([][]float64, len(matrix))
+	for i, row := range matrix {
+		result[i] = make([]float64, len(row))
+		for j, value := range row {
+			result[i][j] = float64(value)
+		}
+	}
+	return result
+}
@@ -0,0 +1,101 @@
+package client
+
+import (
+	"testing"
+
+	pb "github.com/gmarseglia/SDCC-Common/proto"
+)
+
+// square returns a kernel of rows rows, each of the given number of values
+func square(rows int, values int) *pb.Matrix {
+	kernel := &pb.Matrix{}
+	for i := 0; i < rows; i++ {
+		kernel.Rows = append(kernel.Rows, &pb.Row{Values: make([]float32, values)})
+	}
+	return kernel
+}
+
+func TestCheckKernelShape(t *testing.T) {
+	ragged := square(3, 3)
+	ragged.Rows[1].Values = ragged.Rows[1].Values[:2]
+
+	tests := []struct {
+		name    string
+		kernels []*pb.Matrix
+		size    int
+		wantErr bool
+	}{
+		{"valid", []*pb.Matrix{square(3, 3), square(3, 3)}, 3, false},
+		{"no kernels", nil, 3, false},
+		{"ragged", []*pb.Matrix{square(3, 3), ragged}, 3, true},
+		{"too few rows", []*pb.Matrix{square(3, 3), square(2, 3)}, 3, true},
+		{"too many rows", []*pb.Matrix{square(4, 3)}, 3, true},
+		{"too many values", []*pb.Matrix{square(3, 4)}, 3, true},
+		{"empty kernel", []*pb.Matrix{square(3, 3), {}}, 3, true},
+		{"empty kernels, when not used", []*pb.Matrix{{}, {}}, 0, false},
+		{"empty rows", []*pb.Matrix{square(1, 0)}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckKernelShape(tt.kernels, tt.size)
+			if tt.wantErr && err == nil {
+				t.Error("CheckKernelShape succeeded")
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("CheckKernelShape failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateParams(t *testing.T) {
+	tests := []struct {
+		name                   string
+		targetSize, kernelSize int
+		useKernels             bool
+		wantErr                bool
+	}{
+		{"smaller kernel", 8, 3, true, false},
+		{"kernel as large as the target", 8, 8, true, false},
+		{"kernel larger than the target", 3, 4, true, true},
+		{"empty kernel", 3, 0, true, true},
+		{"no kernels", 3, 4, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateParams(tt.targetSize, tt.kernelSize, tt.useKernels)
+			if tt.wantErr && err == nil {
+				t.Error("ValidateParams succeeded")
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("ValidateParams failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestBuildRequestRejectsMalformedTargets(t *testing.T) {
+	req := testRequest(1)
+	ragged := append([][]float32{}, req.Target...)
+	ragged[len(ragged)-1] = ragged[len(ragged)-1][:len(ragged)-1]
+	for name, target := range map[string][][]float32{
+		"empty":      {},
+		"ragged":     ragged,
+		"not square": req.Target[:len(req.Target)-1],
+	} {
+		if _, err := BuildRequest(Request{Target: target, Kernels: req.Kernels, AvgPoolSize: 2}); err == nil {
+			t.Errorf("%s: BuildRequest succeeded", name)
+		}
+	}
+}
+
+func TestBuildRequestRejectsMalformedKernels(t *testing.T) {
+	req := testRequest(2)
+	for name, kernels := range map[string][][][]float32{
+		"ragged":             {req.Kernels[0], {{1, 2, 3}, {4, 5}, {6, 7, 8}}},
+		"empty":              {{}, {}},
+		"larger than target": {make([][]float32, 9)},
+	} {
+		if _, err := BuildRequest(Request{Target: req.Target, Kernels: kernels, AvgPoolSize: 2}); err == nil {
+			t.Errorf("%s: BuildRequest succeeded", name)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"client/client"
+)
+
+func TestOutcome(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, "OK"},
+		{status.Error(codes.Unavailable, "down"), "Unavailable"},
+		{errors.New("not a status"), "Unknown"},
+		{clientError{client.ErrTooLarge}, "ClientError"},
+		{fmt.Errorf("request #1: %w", clientError{errors.New("verification failed")}), "ClientError"},
+	}
+	for _, tt := range tests {
+		if got := outcome(tt.err); got != tt.want {
+			t.Errorf("outcome(%v) = %s, expected %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestCounterUnique(t *testing.T) {
+	defer counter.Store(0)
+	const goroutines, ids = 8, 1000
+	minted := make([][]int64, goroutines)
+	var wg sync.WaitGroup
+	for g := range minted {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < ids; i++ {
+				minted[g] = append(minted[g], counter.Add(1))
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	seen := map[int64]bool{}
+	for _, list := range minted {
+		for i, id := range list {
+			if seen[id] {
+				t.Fatalf("id %d minted twice", id)
+			}
+			if i > 0 && id <= list[i-1] {
+				t.Fatalf("id %d minted after %d", id, list[i-1])
+			}
+			seen[id] = true
+		}
+	}
+	if len(seen) != goroutines*ids {
+		t.Errorf("got %d ids, expected %d", len(seen), goroutines*ids)
+	}
+}
+
+// BenchmarkCounterAdd mints ids from every goroutine at once, with the atomic counter
+// and with a counter guarded by a mutex as counterLock once did
+func BenchmarkCounterAdd(b *testing.B) {
+	b.Run("atomic", func(b *testing.B) {
+		defer counter.Store(0)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				counter.Add(1)
+			}
+		})
+	})
+	b.Run("mutex", func(b *testing.B) {
+		var lock sync.Mutex
+		var n int
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				lock.Lock()
+				n++
+				lock.Unlock()
+			}
+		})
+	})
+}
+
+// BenchmarkGenerateRequest builds the requests of a run, as convolutionalRun does before sending them
+func BenchmarkGenerateRequest(b *testing.B) {
+	for _, targetSize := range []int{64, 256} {
+		b.Run(fmt.Sprintf("target %d", targetSize), func(b *testing.B) {
+			setupRun(b, nil, "-TargetSize", fmt.Sprint(targetSize), "-KernelNum", "8", "-KernelSize", "5")
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := generateRequest(i, targetSize, 8, 5, 2, true, false); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
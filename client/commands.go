@@ -0,0 +1,169 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// the flags of every command: connection, logging and the shape of the requests
+var commonFlags = []string{
+	"Config", "PrintConfig", "FrontAddr", "FrontPort", "CompareAddr", "TLS", "CACert", "ClientCert", "ClientKey", "AuthToken", "AuthTokenFile",
+	"Timeout", "SoftTimeout", "ConnectTimeout", "WaitForReady", "Discover", "HealthCheck", "Connections", "Compression", "MaxMsgSize", "PrintSizes", "KeepaliveTime", "KeepaliveTimeout", "PermitWithoutStream",
+	"MaxRetries", "RetryBackoff", "MaxBackoff", "BackoffPolicy", "RetryBudget", "InjectFailureRate", "RetryFailed", "TraceParent", "OtelEndpoint", "LogFormat", "LogLevel", "LogFile", "LogTee",
+	"TargetSize", "KernelNum", "KernelSize", "AvgPoolSize", "NoPool", "Profile", "UseSigmoid", "Activation", "Precision", "Fill", "KernelDist", "KernelMean", "KernelStdDev", "ValueMin", "ValueMax", "ShareInput", "RandomValues", "ManualValues",
+	"TargetFile", "TargetImage", "NumpyFile", "KernelDir", "Seed", "SplitKernels", "RequestCount", "RecordRequests", "ReplayRequests", "StrictResults", "StopOnErrorCount", "FailFast", "AbortOnFatal", "DryRun",
+}
+
+// command is a subcommand, exposing only the flags relevant to its use
+type command struct {
+	name    string
+	summary string
+	flags   []string
+	// presets are the flags the command always sets
+	presets map[string]string
+}
+
+var commands = []command{
+	{
+		name:    "run",
+		summary: "Send a few requests and print their results.",
+		flags: []string{"Verbose", "ResultLimit", "Reduce", "PrintPrecision", "PrintMax", "ResultDir", "ResultImageDir", "CSVOut", "JSONOut", "HdrOut", "PrintIDMap",
+			"Verify", "Tolerance", "VerifySample", "PrintChecksum", "ExpectChecksum"},
+	},
+	{
+		name:    "benchmark",
+		summary: "Load test the front service and report the statistics.",
+		flags: []string{"SizeSweep", "Concurrency", "MaxInFlightBytes", "Rate", "RampUp", "LaunchDelay", "BatchSize", "WaitBetweenBatches", "Duration", "Warmup",
+			"CSVOut", "JSONOut", "HdrOut", "PrintIDMap", "MetricsAddr", "Progress", "Histogram", "HistogramBuckets"},
+	},
+	{
+		name:    "verify",
+		summary: "Check the results of the front service against the local reference.",
+		flags:   []string{"Tolerance", "VerifySample", "PrintChecksum", "ExpectChecksum", "ResultDir", "ResultImageDir"},
+		presets: map[string]string{"Verify": "true"},
+	},
+}
+
+// the nesting of @files allowed, to stop a file including itself
+const maxArgsFileDepth = 8
+
+// expandArgsFiles replaces every @path in args with the arguments in the file at path, one per line, skipping blank
+// lines and the # comments. The lines can include other files, and are not expanded after --.
+// A line such as "-Fill random" is the flag and its value, passed as -Fill=random so that a bool flag takes its value as well
+func expandArgsFiles(args []string, depth int) ([]string, error) {
+	var expanded []string
+	for i, arg := range args {
+		if arg == "--" {
+			return append(expanded, args[i:]...), nil
+		}
+		if !strings.HasPrefix(arg, "@") || len(arg) == 1 {
+			expanded = append(expanded, arg)
+			continue
+		}
+		if depth >= maxArgsFileDepth {
+			return nil, fmt.Errorf("%s: more than %d nested @files", arg[1:], maxArgsFileDepth)
+		}
+
+		data, err := os.ReadFile(arg[1:])
+		if err != nil {
+			return nil, err
+		}
+		var lines []string
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			// the value of a flag given apart keeps its inner spaces
+			if space := strings.IndexFunc(line, unicode.IsSpace); space > 0 && strings.HasPrefix(line, "-") && !strings.Contains(line[:space], "=") {
+				lines = append(lines, line[:space]+"="+strings.TrimSpace(line[space:]))
+				continue
+			}
+			lines = append(lines, line)
+		}
+		included, err := expandArgsFiles(lines, depth+1)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", arg[1:], err)
+		}
+		expanded = append(expanded, included...)
+	}
+	return expanded, nil
+}
+
+// parseCommandLine parses args, optionally starting with a command, and returns the flags given explicitly.
+// It fails on the arguments left after the flags, which would be ignored otherwise
+func parseCommandLine(args []string) (map[string]bool, error) {
+	flag.CommandLine.Usage = usage
+	if len(args) > 0 {
+		for _, cmd := range commands {
+			if args[0] == cmd.name {
+				return cmd.parse(args[1:])
+			}
+		}
+	}
+
+	// without a command every flag is available, as before the commands
+	flag.CommandLine.Parse(args)
+	if flag.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments after the flags: %s", strings.Join(flag.Args(), " "))
+	}
+	return setFlags(), nil
+}
+
+// parse parses args with the flags of the command, then applies its presets
+func (cmd command) parse(args []string) (map[string]bool, error) {
+	fs := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+	for _, name := range append(commonFlags, cmd.flags...) {
+		// the flags share the values of the global ones
+		f := flag.Lookup(name)
+		fs.Var(f.Value, f.Name, f.Usage)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s [flags]\n%s\n\n", os.Args[0], cmd.name, cmd.summary)
+		printFlags(fs)
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments after the flags of %s: %s", cmd.name, strings.Join(fs.Args(), " "))
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	for name, value := range cmd.presets {
+		flag.Set(name, value)
+		set[name] = true
+	}
+	return set, nil
+}
+
+// usage prints the commands, then every flag available without a command
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [command] [flags]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(out, "\nWithout a command, every flag is available:\n")
+	printFlags(flag.CommandLine)
+}
+
+// hiddenFlags are the testing aids, available but left out of the usage
+var hiddenFlags = map[string]bool{"InjectFailureRate": true}
+
+// printFlags prints the defaults of the flags of fs, but the hidden ones
+func printFlags(fs *flag.FlagSet) {
+	shown := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	shown.SetOutput(fs.Output())
+	fs.VisitAll(func(f *flag.Flag) {
+		if !hiddenFlags[f.Name] {
+			shown.Var(f.Value, f.Name, f.Usage)
+			shown.Lookup(f.Name).DefValue = f.DefValue
+		}
+	})
+	shown.PrintDefaults()
+}
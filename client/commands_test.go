@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeArgsFile writes content to a file named name in dir and returns its path
+func writeArgsFile(t *testing.T, dir string, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExpandArgsFiles(t *testing.T) {
+	dir := t.TempDir()
+	nested := writeArgsFile(t, dir, "nested.args", "-KernelNum 4\n")
+	path := writeArgsFile(t, dir, "run.args", "# a comment\n\n-ShareInput true\n-Fill   random\n-TargetFile my target.txt\n-TargetSize=8\n-UseSigmoid\n@"+nested+"\n")
+
+	got, err := expandArgsFiles([]string{"run", "@" + path, "-Seed", "3", "--", "@" + path}, 0)
+	if err != nil {
+		t.Fatalf("expandArgsFiles failed: %v", err)
+	}
+	want := []string{"run", "-ShareInput=true", "-Fill=random", "-TargetFile=my target.txt", "-TargetSize=8", "-UseSigmoid", "-KernelNum=4",
+		"-Seed", "3", "--", "@" + path}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, expected %q", got, want)
+	}
+}
+
+func TestExpandArgsFilesErrors(t *testing.T) {
+	dir := t.TempDir()
+	self := filepath.Join(dir, "self.args")
+	writeArgsFile(t, dir, "self.args", "@"+self+"\n")
+	for name, args := range map[string][]string{
+		"missing file":   {"@" + filepath.Join(dir, "missing.args")},
+		"including self": {"@" + self},
+	} {
+		if _, err := expandArgsFiles(args, 0); err == nil {
+			t.Errorf("%s: expandArgsFiles succeeded", name)
+		}
+	}
+}
+
+func TestParseCommandLineLeftoverArgs(t *testing.T) {
+	shareInput := *ShareInput
+	defer func() { *ShareInput = shareInput }()
+
+	// a bool flag given apart from its value would stop the parsing at the value
+	for _, args := range [][]string{
+		{"-ShareInput", "true"},
+		{"run", "-ShareInput", "true"},
+		{"run", "extra"},
+	} {
+		if _, err := parseCommandLine(args); err == nil {
+			t.Errorf("parseCommandLine(%q) succeeded", args)
+		}
+	}
+
+	set, err := parseCommandLine([]string{"run", "-ShareInput=true"})
+	if err != nil {
+		t.Fatalf("parseCommandLine failed: %v", err)
+	}
+	if !set["ShareInput"] || !*ShareInput {
+		t.Errorf("ShareInput not set: %v", set)
+	}
+}
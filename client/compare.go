@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+
+	pb "github.com/gmarseglia/SDCC-Common/proto"
+
+	"client/client"
+)
+
+var (
+	compareConn   *grpc.ClientConn
+	compareClient pb.FrontClient
+	comparedCount atomic.Int64
+	divergedCount atomic.Int64
+)
+
+// compareRun sends request to the compared front service as well, and checks that its results match results
+func compareRun(ctx context.Context, clog logger, name string, requestID string, request *pb.ConvolutionalLayerFrontRequest,
+	results []*pb.Matrix) error {
+	c, _ := newFrontClient(clog, name+" (compared)", compareClient, *MaxRetries)
+	r, _, err := c.Send(ctx, requestID, request)
+	if err != nil {
+		logUnsuccessful(clog, name+" (compared)", err)
+		return err
+	}
+	comparedCount.Add(1)
+	if err := client.CompareResults(results, r.GetResult(), tolerance); err != nil {
+		divergedCount.Add(1)
+		clog.Errorf("%s -> WARNING, results differ from %s! %v", name, *CompareAddr, err)
+		return clientError{err}
+	}
+	clog.Printf("%s -> Compared %d results with %s.", name, len(results), *CompareAddr)
+	return nil
+}
+
+// printComparison logs how many of the compared requests diverged
+func printComparison() {
+	mainLog.Summaryf("Compared with %s. Compared: %d, Diverged: %d.", *CompareAddr, comparedCount.Load(), divergedCount.Load())
+}
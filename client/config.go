@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the parameters that can be set from a YAML file, keyed by flag name
+type Config struct {
+	FrontAddr           *string `yaml:"FrontAddr"`
+	FrontPort           *string `yaml:"FrontPort"`
+	CompareAddr         *string `yaml:"CompareAddr"`
+	RequestCount        *string `yaml:"RequestCount"`
+	RecordRequests      *string `yaml:"RecordRequests"`
+	ReplayRequests      *string `yaml:"ReplayRequests"`
+	KernelDir           *string `yaml:"KernelDir"`
+	TargetImage         *string `yaml:"TargetImage"`
+	NumpyFile           *string `yaml:"NumpyFile"`
+	TargetFile          *string `yaml:"TargetFile"`
+	Verbose             *bool   `yaml:"Verbose"`
+	ResultLimit         *int    `yaml:"ResultLimit"`
+	Reduce              *string `yaml:"Reduce"`
+	PrintPrecision      *int    `yaml:"PrintPrecision"`
+	PrintMax            *int    `yaml:"PrintMax"`
+	SizeSweep           *string `yaml:"SizeSweep"`
+	TargetSize          *int    `yaml:"TargetSize"`
+	KernelNum           *int    `yaml:"KernelNum"`
+	KernelSize          *int    `yaml:"KernelSize"`
+	AvgPoolSize         *int    `yaml:"AvgPoolSize"`
+	Profile             *string `yaml:"Profile"`
+	NoPool              *bool   `yaml:"NoPool"`
+	UseSigmoid          *bool   `yaml:"UseSigmoid"`
+	Activation          *string `yaml:"Activation"`
+	Precision           *string `yaml:"Precision"`
+	Fill                *string `yaml:"Fill"`
+	KernelDist          *string `yaml:"KernelDist"`
+	KernelMean          *string `yaml:"KernelMean"`
+	KernelStdDev        *string `yaml:"KernelStdDev"`
+	ValueMin            *string `yaml:"ValueMin"`
+	ValueMax            *string `yaml:"ValueMax"`
+	ShareInput          *bool   `yaml:"ShareInput"`
+	RandomValues        *bool   `yaml:"RandomValues"`
+	ManualValues        *bool   `yaml:"ManualValues"`
+	MaxMsgSize          *int    `yaml:"MaxMsgSize"`
+	PrintSizes          *bool   `yaml:"PrintSizes"`
+	TLS                 *bool   `yaml:"TLS"`
+	CACert              *string `yaml:"CACert"`
+	ClientCert          *string `yaml:"ClientCert"`
+	ClientKey           *string `yaml:"ClientKey"`
+	SplitKernels        *bool   `yaml:"SplitKernels"`
+	AuthToken           *string `yaml:"AuthToken"`
+	AuthTokenFile       *string `yaml:"AuthTokenFile"`
+	Timeout             *string `yaml:"Timeout"`
+	SoftTimeout         *string `yaml:"SoftTimeout"`
+	ConnectTimeout      *string `yaml:"ConnectTimeout"`
+	WaitForReady        *bool   `yaml:"WaitForReady"`
+	Discover            *bool   `yaml:"Discover"`
+	HealthCheck         *bool   `yaml:"HealthCheck"`
+	Compression         *string `yaml:"Compression"`
+	KeepaliveTime       *string `yaml:"KeepaliveTime"`
+	KeepaliveTimeout    *string `yaml:"KeepaliveTimeout"`
+	ResultDir           *string `yaml:"ResultDir"`
+	ResultImageDir      *string `yaml:"ResultImageDir"`
+	OtelEndpoint        *string `yaml:"OtelEndpoint"`
+	MetricsAddr         *string `yaml:"MetricsAddr"`
+	JSONOut             *string `yaml:"JSONOut"`
+	HdrOut              *string `yaml:"HdrOut"`
+	CSVOut              *string `yaml:"CSVOut"`
+	PrintIDMap          *bool   `yaml:"PrintIDMap"`
+	Warmup              *int    `yaml:"Warmup"`
+	Duration            *string `yaml:"Duration"`
+	Rate                *string `yaml:"Rate"`
+	RampUp              *string `yaml:"RampUp"`
+	LaunchDelay         *string `yaml:"LaunchDelay"`
+	Connections         *int    `yaml:"Connections"`
+	Concurrency         *int    `yaml:"Concurrency"`
+	BatchSize           *int    `yaml:"BatchSize"`
+	WaitBetweenBatches  *string `yaml:"WaitBetweenBatches"`
+	MaxInFlightBytes    *int    `yaml:"MaxInFlightBytes"`
+	StopOnErrorCount    *int    `yaml:"StopOnErrorCount"`
+	FailFast            *bool   `yaml:"FailFast"`
+	AbortOnFatal        *bool   `yaml:"AbortOnFatal"`
+	PermitWithoutStream *bool   `yaml:"PermitWithoutStream"`
+	MaxRetries          *int    `yaml:"MaxRetries"`
+	Verify              *bool   `yaml:"Verify"`
+	Tolerance           *string `yaml:"Tolerance"`
+	VerifySample        *string `yaml:"VerifySample"`
+	StrictResults       *bool   `yaml:"StrictResults"`
+	ExpectChecksum      *string `yaml:"ExpectChecksum"`
+	PrintChecksum       *bool   `yaml:"PrintChecksum"`
+	LogFormat           *string `yaml:"LogFormat"`
+	TraceParent         *string `yaml:"TraceParent"`
+	Progress            *bool   `yaml:"Progress"`
+	RetryFailed         *bool   `yaml:"RetryFailed"`
+	Histogram           *bool   `yaml:"Histogram"`
+	HistogramBuckets    *int    `yaml:"HistogramBuckets"`
+	LogFile             *string `yaml:"LogFile"`
+	LogTee              *bool   `yaml:"LogTee"`
+	LogLevel            *string `yaml:"LogLevel"`
+	DryRun              *bool   `yaml:"DryRun"`
+	Seed                *string `yaml:"Seed"`
+	RetryBackoff        *string `yaml:"RetryBackoff"`
+	MaxBackoff          *string `yaml:"MaxBackoff"`
+	BackoffPolicy       *string `yaml:"BackoffPolicy"`
+	RetryBudget         *string `yaml:"RetryBudget"`
+	InjectFailureRate   *string `yaml:"InjectFailureRate"`
+}
+
+// secretFlags are redacted whenever the parameters are printed
+var secretFlags = map[string]bool{"AuthToken": true}
+
+// redactedValue returns the value of f as printed, hiding the secrets
+func redactedValue(f *flag.Flag) string {
+	if secretFlags[f.Name] && f.Value.String() != "" {
+		return "REDACTED"
+	}
+	return f.Value.String()
+}
+
+// effectiveConfig returns the typed value of every parameter, as resolved by setupFields, keyed as a Config
+func effectiveConfig() map[string]any {
+	config := map[string]any{}
+	flag.VisitAll(func(f *flag.Flag) {
+		if f.Name == "Config" || f.Name == "PrintConfig" {
+			return
+		}
+		if secretFlags[f.Name] {
+			config[f.Name] = redactedValue(f)
+			return
+		}
+		config[f.Name] = f.Value.(flag.Getter).Get()
+	})
+	return config
+}
+
+// configLine formats config on a single line, as Name=value pairs sorted by name
+func configLine(config map[string]any) string {
+	names := make([]string, 0, len(config))
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=%v", name, config[name])
+	}
+	return strings.Join(pairs, " ")
+}
+
+// setFlags returns the names of the flags given explicitly on the command line
+func setFlags() map[string]bool {
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
+
+// envName returns the environment variable of a flag, e.g. SDCC_FRONT_ADDR for FrontAddr
+func envName(flagName string) string {
+	var b strings.Builder
+	b.WriteString("SDCC_")
+	runes := []rune(flagName)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+// loadEnv sets every flag not in skip from its environment variable, adding it to skip
+func loadEnv(skip map[string]bool) error {
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		if skip[f.Name] || err != nil {
+			return
+		}
+		value, found := os.LookupEnv(envName(f.Name))
+		if !found {
+			return
+		}
+		if err = flag.Set(f.Name, value); err != nil {
+			err = fmt.Errorf("%s: %w", envName(f.Name), err)
+			return
+		}
+		skip[f.Name] = true
+	})
+	return err
+}
+
+// loadConfig reads the YAML file at path and sets every flag it contains that is not in skip
+func loadConfig(path string, skip map[string]bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var config Config
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	v := reflect.ValueOf(config)
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Tag.Get("yaml")
+		field := v.Field(i)
+		if field.IsNil() || skip[name] {
+			continue
+		}
+		if err := flag.Set(name, fmt.Sprint(field.Elem().Interface())); err != nil {
+			return fmt.Errorf("%s: %s: %w", path, name, err)
+		}
+	}
+	return nil
+}
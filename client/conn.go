@@ -0,0 +1,406 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/gmarseglia/SDCC-Common/proto"
+
+	"client/client"
+)
+
+var (
+	conns      []*grpc.ClientConn
+	clients    []pb.FrontClient
+	nextClient atomic.Uint64
+)
+
+// connect sets up the clients of the front service, one per connection
+func connect() error {
+	// Set up the transport credentials
+	creds, err := transportCredentials()
+	if err != nil {
+		return fmt.Errorf("could not set up TLS: %w", err)
+	}
+
+	// Set up the dial options
+	opts := append(client.DialOptions(frontOptions),
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(timedCodec{})),
+		// bound every attempt to connect, not only the first wait
+		grpc.WithConnectParams(grpc.ConnectParams{Backoff: backoff.DefaultConfig, MinConnectTimeout: connectTimeout}),
+	)
+	if *AuthToken != "" || *AuthTokenFile != "" {
+		tokenCreds, err := newTokenCredentials(*AuthToken, *AuthTokenFile)
+		if err != nil {
+			return fmt.Errorf("could not set up the auth token: %w", err)
+		}
+		if !*TLS {
+			mainLog.Printf("WARNING, the auth token is sent without TLS.")
+		}
+		opts = append(opts, grpc.WithPerRPCCredentials(tokenCreds))
+	}
+	if *OtelEndpoint != "" {
+		opts = append(opts, grpc.WithStatsHandler(otelgrpc.NewClientHandler()))
+	}
+	if keepaliveTime > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                keepaliveTime,
+			Timeout:             keepaliveTimeout,
+			PermitWithoutStream: *PermitWithoutStream,
+		}))
+		mainLog.Debugf("Keepalive every %v, timeout %v, without stream: %v.", keepaliveTime, keepaliveTimeout, *PermitWithoutStream)
+	}
+
+	// Set up a client for the gRPC server, the connection is established by the first request
+	addrs := frontAddresses(*FrontAddr, *FrontPort)
+	if len(addrs) == 0 {
+		return fmt.Errorf("FrontAddr contains no address: %s", *FrontAddr)
+	}
+	for _, addr := range addrs {
+		path, ok := unixSocketPath(addr)
+		if !ok {
+			continue
+		}
+		// the manual resolver of several addresses only dials TCP
+		if len(addrs) > 1 {
+			return fmt.Errorf("a UNIX socket must be the only address of FrontAddr: %s", *FrontAddr)
+		}
+		if info, err := os.Stat(path); err != nil {
+			return fmt.Errorf("could not find the UNIX socket of FrontAddr: %w", err)
+		} else if info.Mode()&os.ModeSocket == 0 {
+			return fmt.Errorf("FrontAddr %s is not a UNIX socket", path)
+		}
+	}
+	if len(addrs) > 1 {
+		mainLog.Printf("Balancing requests across %d addresses: %v", len(addrs), addrs)
+	}
+	if *Connections > 1 {
+		mainLog.Printf("Opening %d connections to each address.", *Connections)
+	}
+
+	// every ClientConn has its own connections, and a manual resolver serves a single ClientConn
+	pool = newConnPool(opts...)
+	for i := 0; i < *Connections; i++ {
+		serverFullAddr, targetOpts := frontTarget(addrs)
+		conn, err := pool.get(fmt.Sprintf("front-%d", i), serverFullAddr, targetOpts...)
+		if err != nil {
+			return fmt.Errorf("could not create the client: %w", err)
+		}
+		conns = append(conns, conn)
+
+		// wait for the connection, so that a wrong address fails once instead of on every request
+		if *WaitForReady {
+			mainLog.Printf("Waiting for connection to %s...", serverFullAddr)
+			if err := waitForReady(conn, connectTimeout); err != nil {
+				return fmt.Errorf("could not connect to %s within ConnectTimeout %v: %w", serverFullAddr, connectTimeout, err)
+			}
+			mainLog.Printf("Connected to %s.", serverFullAddr)
+		}
+
+		// create the client object
+		clients = append(clients, pb.NewFrontClient(conn))
+	}
+
+	// a single connection to the compared front service, which only checks the results
+	if *CompareAddr != "" {
+		compareAddrs := frontAddresses(*CompareAddr, *FrontPort)
+		if len(compareAddrs) == 0 {
+			return fmt.Errorf("CompareAddr contains no address: %s", *CompareAddr)
+		}
+		compareFullAddr, targetOpts := frontTarget(compareAddrs)
+		conn, err := pool.get("compare", compareFullAddr, targetOpts...)
+		if err != nil {
+			return fmt.Errorf("could not create the client of CompareAddr: %w", err)
+		}
+		compareConn = conn
+		if *WaitForReady {
+			mainLog.Printf("Waiting for connection to %s...", compareFullAddr)
+			if err := waitForReady(conn, connectTimeout); err != nil {
+				return fmt.Errorf("could not connect to %s within ConnectTimeout %v: %w", compareFullAddr, connectTimeout, err)
+			}
+			mainLog.Printf("Connected to %s.", compareFullAddr)
+		}
+		compareClient = pb.NewFrontClient(conn)
+		mainLog.Printf("Comparing the results with %s.", compareFullAddr)
+	}
+	return nil
+}
+
+// frontClient returns the next client, in turn, so that the calls are spread across the connections
+func frontClient() pb.FrontClient {
+	return clients[(nextClient.Add(1)-1)%uint64(len(clients))]
+}
+
+// transportCredentials returns the credentials used to dial the front service
+func transportCredentials() (credentials.TransportCredentials, error) {
+	if !*TLS {
+		return insecure.NewCredentials(), nil
+	}
+
+	tlsConfig := &tls.Config{}
+
+	// without a CA bundle the system roots are used
+	if *CACert != "" {
+		caPEM, err := os.ReadFile(*CACert)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA certificate %s: %w", *CACert, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("could not parse CA certificate %s", *CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	// present a client certificate for mutual TLS
+	if *ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(*ClientCert, *ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client key pair %s, %s: %w", *ClientCert, *ClientKey, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// frontAddresses splits a comma-separated list of addresses, adding port to those without one but the UNIX sockets
+func frontAddresses(addrs string, port string) []string {
+	var result []string
+	for _, addr := range strings.Split(addrs, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		if _, ok := unixSocketPath(addr); ok {
+			result = append(result, addr)
+			continue
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, port)
+		}
+		result = append(result, addr)
+	}
+	return result
+}
+
+// unixSocketPath returns the path of addr if it is a UNIX socket, as unix:path or unix:///absolute/path,
+// the targets dialed by gRPC
+func unixSocketPath(addr string) (string, bool) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return "", false
+	}
+	if absolute, ok := strings.CutPrefix(path, "//"); ok {
+		path = absolute
+	}
+	return path, true
+}
+
+// frontTarget returns the target to dial and the options to balance requests across addrs
+func frontTarget(addrs []string) (string, []grpc.DialOption) {
+	if len(addrs) == 1 {
+		return addrs[0], nil
+	}
+
+	// resolve all the addresses at once and use them in turn
+	state := resolver.State{}
+	for _, addr := range addrs {
+		state.Addresses = append(state.Addresses, resolver.Address{Addr: addr})
+	}
+	r := manual.NewBuilderWithScheme("sdcc")
+	r.InitialState(state)
+
+	return r.Scheme() + ":///front", []grpc.DialOption{
+		grpc.WithResolvers(r),
+		grpc.WithDefaultServiceConfig(`{"loadBalancingConfig": [{"round_robin": {}}]}`),
+	}
+}
+
+// waitForReady blocks until conn is ready or the timeout expires
+func waitForReady(conn *grpc.ClientConn, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// leave the idle state, NewClient does not connect by itself
+	conn.Connect()
+
+	for {
+		state := conn.GetState()
+		if state == connectivity.Ready {
+			return nil
+		}
+		if !conn.WaitForStateChange(ctx, state) {
+			return fmt.Errorf("connection not ready after %v, last state: %v", timeout, state)
+		}
+	}
+}
+
+type callStatsKey struct{}
+
+// callStats holds the latency and the uncompressed and wire sizes of a single call.
+// The latency excludes the time spent encoding the request and decoding the reply, on the client, and is split
+// into the time spent getting a connection, dialing and handshaking when there is none ready,
+// and the time spent in the call itself, sending the request, computing and receiving the reply
+type callStats struct {
+	latency      time.Duration
+	connect      time.Duration
+	call         time.Duration
+	encode       time.Duration
+	decode       time.Duration
+	sent         int
+	sentWire     int
+	received     int
+	receivedWire int
+
+	// the start of the attempt, and of its stream on the connection
+	begin  time.Time
+	stream time.Time
+}
+
+// add sums the statistics of other into cs, as for the sub-requests of a request
+func (cs *callStats) add(other *callStats) {
+	cs.latency += other.latency
+	cs.connect += other.connect
+	cs.call += other.call
+	cs.encode += other.encode
+	cs.decode += other.decode
+	cs.sent += other.sent
+	cs.sentWire += other.sentWire
+	cs.received += other.received
+	cs.receivedWire += other.receivedWire
+}
+
+// withCallStats makes the statistics of the call made with ctx be recorded into cs
+func withCallStats(ctx context.Context, cs *callStats) context.Context {
+	return context.WithValue(ctx, callStatsKey{}, cs)
+}
+
+// callInterceptor times every call and logs its method, duration, status and payload sizes
+func callInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	// the sizes are recorded by the stats handler, tag the call if the caller did not
+	cs, ok := ctx.Value(callStatsKey{}).(*callStats)
+	if !ok {
+		cs = &callStats{}
+		ctx = withCallStats(ctx, cs)
+	}
+
+	// the messages lead the codec to the statistics of the call
+	codecStats.Store(req, cs)
+	codecStats.Store(reply, cs)
+	defer codecStats.Delete(req)
+	defer codecStats.Delete(reply)
+
+	start := time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	cs.latency = time.Since(start) - cs.encode - cs.decode
+
+	requestID := "-"
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get("x-request-id")) > 0 {
+		requestID = md.Get("x-request-id")[0]
+	}
+	clientLog.with("method", method).with("x_request_id", requestID).with("latency_ms", ms(cs.latency)).
+		Debugf("Call %s (x-request-id: %s) -> %v in %d ms (connection: %.2f ms, call: %.2f ms, encoding: %.2f ms, decoding: %.2f ms). Payload sent: %d bytes (%d on the wire), received: %d bytes (%d on the wire)",
+			method, requestID, status.Code(err), cs.latency.Milliseconds(), ms(cs.connect), ms(cs.call), ms(cs.encode), ms(cs.decode), cs.sent, cs.sentWire, cs.received, cs.receivedWire)
+	return err
+}
+
+// payloadStatsHandler records the payload sizes and the latency breakdown of the calls tagged with withCallStats
+type payloadStatsHandler struct{}
+
+func (payloadStatsHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (payloadStatsHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	cs, ok := ctx.Value(callStatsKey{}).(*callStats)
+	if !ok {
+		return
+	}
+	switch p := s.(type) {
+	case *stats.Begin:
+		cs.begin = p.BeginTime
+	case *stats.OutHeader:
+		// the headers are sent once the attempt has a stream on a ready connection
+		cs.stream = time.Now()
+		cs.connect = cs.stream.Sub(cs.begin)
+	case *stats.End:
+		if !cs.stream.IsZero() {
+			cs.call = p.EndTime.Sub(cs.stream) - cs.encode - cs.decode
+		} else {
+			// the attempt never got a connection
+			cs.connect = p.EndTime.Sub(cs.begin)
+		}
+	case *stats.OutPayload:
+		cs.sent += p.Length
+		cs.sentWire += p.WireLength
+	case *stats.InPayload:
+		cs.received += p.Length
+		cs.receivedWire += p.WireLength
+	}
+}
+
+func (payloadStatsHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (payloadStatsHandler) HandleConn(context.Context, stats.ConnStats) {}
+
+// codecStats maps the messages of the calls in progress to their statistics, for timedCodec
+var codecStats sync.Map
+
+// timedCodec is the proto codec, recording the time spent encoding and decoding the messages of the calls in progress
+type timedCodec struct{}
+
+func (timedCodec) Marshal(v any) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("cannot encode %T, not a proto message", v)
+	}
+	start := time.Now()
+	data, err := proto.Marshal(msg)
+	if cs, ok := codecStats.Load(v); ok {
+		cs.(*callStats).encode += time.Since(start)
+	}
+	return data, err
+}
+
+func (timedCodec) Unmarshal(data []byte, v any) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("cannot decode into %T, not a proto message", v)
+	}
+	start := time.Now()
+	err := proto.Unmarshal(data, msg)
+	if cs, ok := codecStats.Load(v); ok {
+		cs.(*callStats).decode += time.Since(start)
+	}
+	return err
+}
+
+func (timedCodec) Name() string {
+	return "proto"
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/gmarseglia/SDCC-Common/proto"
+)
+
+// writeSelfSigned writes a self-signed certificate and its key to dir, and returns their paths
+func writeSelfSigned(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certPath, keyPath
+}
+
+func TestTransportCredentials(t *testing.T) {
+	dir := t.TempDir()
+	cert, key := writeSelfSigned(t, dir)
+	garbage := filepath.Join(dir, "garbage.pem")
+	if err := os.WriteFile(garbage, []byte("not a certificate"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing.pem")
+
+	tls, caCert, clientCert, clientKey := *TLS, *CACert, *ClientCert, *ClientKey
+	defer func() { *TLS, *CACert, *ClientCert, *ClientKey = tls, caCert, clientCert, clientKey }()
+
+	tests := []struct {
+		name                          string
+		tls                           bool
+		caCert, clientCert, clientKey string
+		wantProtocol                  string
+		wantErr                       bool
+	}{
+		{"insecure", false, "", "", "", "insecure", false},
+		{"system roots", true, "", "", "", "tls", false},
+		{"CA only", true, cert, "", "", "tls", false},
+		{"mutual TLS", true, cert, cert, key, "tls", false},
+		{"missing CA", true, missing, "", "", "", true},
+		{"invalid CA", true, garbage, "", "", "", true},
+		{"missing key", true, cert, cert, missing, "", true},
+		{"invalid client certificate", true, cert, garbage, key, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*TLS, *CACert, *ClientCert, *ClientKey = tt.tls, tt.caCert, tt.clientCert, tt.clientKey
+			creds, err := transportCredentials()
+			if tt.wantErr {
+				if err == nil {
+					t.Error("transportCredentials succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("transportCredentials failed: %v", err)
+			}
+			if got := creds.Info().SecurityProtocol; got != tt.wantProtocol {
+				t.Errorf("got protocol %q, expected %q", got, tt.wantProtocol)
+			}
+		})
+	}
+}
+
+// countingServer is a front service counting its calls
+type countingServer struct {
+	pb.UnimplementedFrontServer
+	calls atomic.Int64
+}
+
+func (s *countingServer) ConvolutionalLayer(ctx context.Context, in *pb.ConvolutionalLayerFrontRequest) (*pb.ConvolutionalLayerFrontReply, error) {
+	s.calls.Add(1)
+	return okReply(ctx, in)
+}
+
+// startFront serves srv on a free local port, until the end of the test, and returns its address
+func startFront(t testing.TB, srv pb.FrontServer) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	pb.RegisterFrontServer(s, srv)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return lis.Addr().String()
+}
+
+func TestFrontTargetRoundRobin(t *testing.T) {
+	servers := []*countingServer{{}, {}}
+	var addrs []string
+	for _, srv := range servers {
+		addrs = append(addrs, startFront(t, srv))
+	}
+
+	target, opts := frontTarget(addrs)
+	conn, err := grpc.NewClient(target, append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := waitForReady(conn, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first calls can all go to the first address ready, the later ones alternate
+	front := pb.NewFrontClient(conn)
+	request := &pb.ConvolutionalLayerFrontRequest{Target: &pb.Matrix{Rows: []*pb.Row{{Values: []float32{1}}}},
+		Kernel: []*pb.Matrix{{Rows: []*pb.Row{{Values: []float32{1}}}}}, AvgPoolSize: 1, UseKernels: true}
+	const calls = 40
+	for i := 0; i < calls; i++ {
+		if _, err := front.ConvolutionalLayer(context.Background(), request); err != nil {
+			t.Fatalf("call %d failed: %v", i, err)
+		}
+	}
+	for i, srv := range servers {
+		if got := srv.calls.Load(); got < calls/4 {
+			t.Errorf("address %d got %d of %d calls, expected at least %d", i, got, calls, calls/4)
+		}
+	}
+}
+
+func TestFrontTargetSingleAddress(t *testing.T) {
+	target, opts := frontTarget([]string{"localhost:55555"})
+	if target != "localhost:55555" || opts != nil {
+		t.Errorf("got %s with %d options, expected the address without options", target, len(opts))
+	}
+}
+
+func TestCallInterceptor(t *testing.T) {
+	logs := setupRun(t, nil, "-LogLevel", "debug")
+
+	request, reply := &pb.ConvolutionalLayerFrontRequest{}, &pb.ConvolutionalLayerFrontReply{}
+	var tagged *callStats
+	invoker := func(ctx context.Context, method string, req, rep any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		tagged, _ = ctx.Value(callStatsKey{}).(*callStats)
+		if _, ok := codecStats.Load(req); !ok {
+			t.Error("the request does not lead to the statistics of the call")
+		}
+		time.Sleep(20 * time.Millisecond)
+		return status.Error(codes.Unavailable, "down")
+	}
+
+	cs := &callStats{}
+	ctx := metadata.AppendToOutgoingContext(withCallStats(context.Background(), cs), "x-request-id", "7")
+	err := callInterceptor(ctx, "/proto.Front/ConvolutionalLayer", request, reply, nil, invoker)
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("got %v, expected the Unavailable of the invoker", err)
+	}
+	if tagged != cs {
+		t.Error("the invoker did not get the statistics of the caller")
+	}
+	if cs.latency < 20*time.Millisecond {
+		t.Errorf("got a latency of %v, expected at least 20ms", cs.latency)
+	}
+	if _, ok := codecStats.Load(request); ok {
+		t.Error("the statistics of the call are kept after it")
+	}
+	if !strings.Contains(logs.String(), "Call /proto.Front/ConvolutionalLayer (x-request-id: 7) -> Unavailable") {
+		t.Errorf("the call is not logged:\n%s", logs)
+	}
+
+	// an untagged call is timed all the same
+	tagged = nil
+	if err := callInterceptor(context.Background(), "/proto.Front/ConvolutionalLayer", request, reply, nil, invoker); status.Code(err) != codes.Unavailable {
+		t.Errorf("got %v, expected the Unavailable of the invoker", err)
+	}
+	if tagged == nil || tagged.latency < 20*time.Millisecond {
+		t.Error("an untagged call is not timed")
+	}
+}
+
+// slowServer is a front service taking a fixed time per call
+type slowServer struct {
+	pb.UnimplementedFrontServer
+}
+
+func (s *slowServer) ConvolutionalLayer(ctx context.Context, in *pb.ConvolutionalLayerFrontRequest) (*pb.ConvolutionalLayerFrontReply, error) {
+	time.Sleep(time.Millisecond)
+	return okReply(ctx, in)
+}
+
+// BenchmarkConnections sends many concurrent requests over one and several connections to the same front service
+func BenchmarkConnections(b *testing.B) {
+	addr := startFront(b, &slowServer{})
+	for _, connections := range []int{1, 4} {
+		b.Run(fmt.Sprintf("connections %d", connections), func(b *testing.B) {
+			setupRun(b, nil, "-FrontAddr", addr, "-Connections", fmt.Sprint(connections))
+			if err := connect(); err != nil {
+				b.Fatal(err)
+			}
+			b.Cleanup(func() {
+				pool.close()
+				conns = nil
+			})
+			b.ResetTimer()
+			sendRequests(b.N, 64)
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	pb "github.com/gmarseglia/SDCC-Common/proto"
+)
+
+// discover checks, with the gRPC reflection service, that the front service of the first connection, and the compared one if any,
+// serve the Front service and its ConvolutionalLayer method, logging the services and the methods they serve
+func discover(ctx context.Context) error {
+	targets := []*grpc.ClientConn{conns[0]}
+	if compareConn != nil {
+		targets = append(targets, compareConn)
+	}
+	for _, conn := range targets {
+		if err := discoverConn(ctx, conn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// discoverConn checks with reflection that the server at the other end of conn serves ConvolutionalLayer
+func discoverConn(ctx context.Context, conn *grpc.ClientConn) error {
+	ctx, cancel := context.WithTimeout(ctx, frontOptions.Timeout)
+	defer cancel()
+
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return fmt.Errorf("reflection of %s failed: %w", conn.Target(), err)
+	}
+	defer stream.CloseSend()
+
+	// the reflection service answers every request on the stream in turn
+	ask := func(request *reflectionpb.ServerReflectionRequest) (*reflectionpb.ServerReflectionResponse, error) {
+		if err := stream.Send(request); err != nil {
+			return nil, err
+		}
+		response, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		if e := response.GetErrorResponse(); e != nil {
+			return nil, status.Error(codes.Code(e.GetErrorCode()), e.GetErrorMessage())
+		}
+		return response, nil
+	}
+
+	response, err := ask(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	})
+	if status.Code(err) == codes.Unimplemented {
+		mainLog.Printf("%s does not implement the reflection service, its methods cannot be discovered.", conn.Target())
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reflection of %s failed: %w", conn.Target(), err)
+	}
+	var services []string
+	for _, service := range response.GetListServicesResponse().GetService() {
+		services = append(services, service.GetName())
+	}
+	sort.Strings(services)
+	mainLog.Printf("%s serves: %s", conn.Target(), strings.Join(services, ", "))
+
+	frontService := pb.Front_ServiceDesc.ServiceName
+	if !slices.Contains(services, frontService) {
+		return fmt.Errorf("%s does not serve %s, check the address and the port", conn.Target(), frontService)
+	}
+
+	// the methods of the service, from the file that declares it
+	response, err = ask(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: frontService},
+	})
+	if err != nil {
+		return fmt.Errorf("reflection of %s on %s failed: %w", frontService, conn.Target(), err)
+	}
+	methods, err := serviceMethods(response.GetFileDescriptorResponse().GetFileDescriptorProto(), frontService)
+	if err != nil {
+		return fmt.Errorf("reflection of %s on %s failed: %w", frontService, conn.Target(), err)
+	}
+	mainLog.Printf("%s methods on %s: %s", frontService, conn.Target(), strings.Join(methods, ", "))
+
+	if !slices.Contains(methods, "ConvolutionalLayer") {
+		return fmt.Errorf("%s on %s has no ConvolutionalLayer method, the server is incompatible", frontService, conn.Target())
+	}
+	return nil
+}
+
+// serviceMethods returns the methods of the fully qualified service declared in one of the encoded files
+func serviceMethods(files [][]byte, service string) ([]string, error) {
+	for _, data := range files {
+		file := &descriptorpb.FileDescriptorProto{}
+		if err := proto.Unmarshal(data, file); err != nil {
+			return nil, err
+		}
+		for _, s := range file.GetService() {
+			if file.GetPackage()+"."+s.GetName() != service {
+				continue
+			}
+			var methods []string
+			for _, m := range s.GetMethod() {
+				methods = append(methods, m.GetName())
+			}
+			return methods, nil
+		}
+	}
+	return nil, fmt.Errorf("no file declares %s", service)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// the fractions of the ramp-up at which the rate is logged
+var rampCheckpoints = []float64{0.25, 0.5, 0.75}
+
+// dispatcher paces the launch of requests and caps the requests in flight
+type dispatcher struct {
+	sem      chan struct{}
+	limiter  *rate.Limiter
+	delay    time.Duration
+	launched int
+
+	// during the ramp-up the rate grows linearly from 0 to perSecond
+	perSecond  float64
+	rampUp     time.Duration
+	start      time.Time
+	ticks      int
+	checkpoint int
+}
+
+// newDispatcher returns a dispatcher launching at most perSecond requests per second, reached after rampUp,
+// or one request every delay if perSecond is 0
+func newDispatcher(concurrency int, perSecond float64, delay time.Duration, rampUp time.Duration) *dispatcher {
+	d := &dispatcher{
+		sem:       make(chan struct{}, concurrency),
+		delay:     delay,
+		perSecond: perSecond,
+		start:     time.Now(),
+	}
+	if perSecond > 0 {
+		d.limiter = rate.NewLimiter(rate.Limit(perSecond), 1)
+		d.rampUp = rampUp
+	}
+	return d
+}
+
+// rampWait waits for the next launch of the ramp-up, it returns false once the ramp-up is over,
+// and whether ctx is still not done
+func (d *dispatcher) rampWait(ctx context.Context) (bool, bool) {
+	// with a linear rate, n requests are launched by sqrt(2 * n * rampUp / perSecond)
+	at := time.Duration(math.Sqrt(2*float64(d.ticks)*d.rampUp.Seconds()/d.perSecond) * float64(time.Second))
+	if at >= d.rampUp {
+		d.rampUp = 0
+		mainLog.Printf("Ramp-up completed, launching %.2f requests per second.", d.perSecond)
+		return false, true
+	}
+	d.ticks++
+
+	// jitter the launches, so that they do not fall on the same instants run after run
+	at = time.Duration(float64(at) * (0.9 + 0.2*rand.Float64()))
+	select {
+	case <-time.After(time.Until(d.start.Add(at))):
+	case <-ctx.Done():
+		return true, false
+	}
+
+	elapsed := time.Since(d.start)
+	for ; d.checkpoint < len(rampCheckpoints) && elapsed >= time.Duration(rampCheckpoints[d.checkpoint]*float64(d.rampUp)); d.checkpoint++ {
+		mainLog.Printf("Ramp-up at %.0f%%, launching %.2f requests per second.",
+			rampCheckpoints[d.checkpoint]*100, d.perSecond*elapsed.Seconds()/d.rampUp.Seconds())
+	}
+	return true, true
+}
+
+// pace waits for the next launch, it returns false once ctx is done
+func (d *dispatcher) pace(ctx context.Context) bool {
+	if d.rampUp > 0 {
+		if ramping, ok := d.rampWait(ctx); ramping {
+			return ok
+		}
+	}
+	if d.limiter != nil {
+		return d.limiter.Wait(ctx) == nil
+	}
+	select {
+	case <-time.After(d.delay):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// next waits for the next launch and a free slot, it returns false once ctx is done
+func (d *dispatcher) next(ctx context.Context) bool {
+	if !d.pace(ctx) {
+		return false
+	}
+
+	select {
+	case d.sem <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// launch runs run in a new goroutine, holding the slot taken by next until it returns
+func (d *dispatcher) launch(run func()) {
+	wg.Add(1)
+	d.launched++
+	go func() {
+		defer func() { <-d.sem }()
+		run()
+	}()
+}
+
+// inFlightBytes bounds the estimated memory of the requests in flight, nil without MaxInFlightBytes
+var inFlightBytes *byteBudget
+
+// byteBudget bounds the bytes taken at once, the takers waiting for the bytes given back by the others
+type byteBudget struct {
+	lock  sync.Mutex
+	limit int64
+	used  int64
+	// freed is closed, and replaced, whenever bytes are given back
+	freed chan struct{}
+}
+
+func newByteBudget(limit int64) *byteBudget {
+	return &byteBudget{limit: limit, freed: make(chan struct{})}
+}
+
+// take waits until n bytes are free and takes them, returning the bytes taken, or ctx's error once done.
+// More than the limit takes the whole budget, so that a large request runs alone rather than never
+func (b *byteBudget) take(ctx context.Context, n int64) (int64, error) {
+	n = min(n, b.limit)
+	for {
+		b.lock.Lock()
+		if b.used+n <= b.limit {
+			b.used += n
+			b.lock.Unlock()
+			return n, nil
+		}
+		freed := b.freed
+		b.lock.Unlock()
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+// give gives back n bytes taken by take
+func (b *byteBudget) give(n int64) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.used -= n
+	close(b.freed)
+	b.freed = make(chan struct{})
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/gmarseglia/SDCC-Common/proto"
+)
+
+// peakFront is a slow front service tracking the peak of its calls in progress
+type peakFront struct {
+	lock     sync.Mutex
+	inFlight int
+	peak     int
+}
+
+func (f *peakFront) call(ctx context.Context, in *pb.ConvolutionalLayerFrontRequest) (*pb.ConvolutionalLayerFrontReply, error) {
+	f.lock.Lock()
+	f.inFlight++
+	f.peak = max(f.peak, f.inFlight)
+	f.lock.Unlock()
+	defer func() {
+		f.lock.Lock()
+		f.inFlight--
+		f.lock.Unlock()
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	return okReply(ctx, in)
+}
+
+func TestDispatcherBoundsConcurrency(t *testing.T) {
+	for _, concurrency := range []int{1, 4} {
+		t.Run(fmt.Sprintf("concurrency %d", concurrency), func(t *testing.T) {
+			front := &peakFront{}
+			setupRun(t, []pb.FrontClient{frontFunc(front.call)})
+
+			records := sendRequests(20, concurrency)
+			if len(records) != 20 {
+				t.Fatalf("got %d records, expected 20", len(records))
+			}
+			if front.peak > concurrency {
+				t.Errorf("got %d calls in progress at once", front.peak)
+			}
+			if concurrency > 1 && front.peak < 2 {
+				t.Error("the calls were never in progress together")
+			}
+		})
+	}
+}
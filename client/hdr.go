@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// the range tracked by the histogram, in nanoseconds, at 3 significant digits
+const (
+	hdrLowest  = int64(time.Microsecond)
+	hdrHighest = int64(time.Hour)
+	hdrDigits  = 3
+)
+
+var (
+	// hdrHistogram holds the latencies of the measured requests, guarded by latenciesLock, nil without HdrOut
+	hdrHistogram *hdrhistogram.Histogram
+	hdrFile      *os.File
+	// the interval timestamps are relative to hdrStart, the StartTime of the log
+	hdrStart time.Time
+)
+
+// openHdr creates the HdrHistogram log at path and writes its header.
+// The lines are written here, as the log writer of the library writes the interval end in place of its length
+func openHdr(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	hdrFile = f
+	hdrStart = time.Now()
+	_, err = fmt.Fprintf(f, "#[Histogram log format version %s]\n#[StartTime: %.3f (seconds since epoch), %s]\n%s\n",
+		hdrhistogram.HISTOGRAM_LOG_FORMAT_VERSION, float64(hdrStart.UnixMilli())/1000, hdrStart.Format(time.RFC3339),
+		`"StartTimestamp","Interval_Length","Interval_Max","Interval_Compressed_Histogram"`)
+	if err != nil {
+		return err
+	}
+
+	latenciesLock.Lock()
+	defer latenciesLock.Unlock()
+	hdrHistogram = hdrhistogram.New(hdrLowest, hdrHighest, hdrDigits)
+	return nil
+}
+
+// recordHdr adds d to the histogram, the caller holds latenciesLock
+func recordHdr(d time.Duration) {
+	if hdrHistogram == nil {
+		return
+	}
+	// a latency out of range is kept at the bound, rather than lost
+	hdrHistogram.RecordValue(min(max(int64(d), hdrLowest), hdrHighest))
+}
+
+// writeHdrInterval writes the latencies recorded since start as an interval of the log, labeled with tag if not empty
+func writeHdrInterval(tag string, start time.Time) error {
+	if hdrFile == nil {
+		return nil
+	}
+	latenciesLock.Lock()
+	defer latenciesLock.Unlock()
+	payload, err := hdrHistogram.Encode(hdrhistogram.V2CompressedEncodingCookieBase)
+	if err != nil {
+		return err
+	}
+	if tag != "" {
+		tag = "Tag=" + tag + ","
+	}
+	// the timestamps in seconds, the maximum in milliseconds
+	_, err = fmt.Fprintf(hdrFile, "%s%.3f,%.3f,%.3f,%s\n", tag, start.Sub(hdrStart).Seconds(), time.Since(start).Seconds(),
+		ms(time.Duration(hdrHistogram.Max())), payload)
+	return err
+}
+
+// closeHdr closes the HdrHistogram log
+func closeHdr() {
+	if hdrFile == nil {
+		return
+	}
+	if err := hdrFile.Close(); err != nil {
+		mainLog.Errorf("Could not write HdrOut: %v", err)
+	}
+	hdrFile = nil
+}
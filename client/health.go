@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/gmarseglia/SDCC-Common/proto"
+	"github.com/gmarseglia/SDCC-Common/utils"
+)
+
+// checkHealth checks that the front service is serving on every connection, and the compared one if any, with the gRPC health service,
+// or with a canary request when the server does not implement it
+func checkHealth(ctx context.Context) error {
+	for i, conn := range conns {
+		if err := checkConnHealth(ctx, conn.Target(), healthpb.NewHealthClient(conn), clients[i]); err != nil {
+			return err
+		}
+	}
+	if compareConn != nil {
+		return checkConnHealth(ctx, compareConn.Target(), healthpb.NewHealthClient(compareConn), compareClient)
+	}
+	return nil
+}
+
+// checkConnHealth checks the front service at target with the health client, falling back to the front client
+func checkConnHealth(ctx context.Context, target string, health healthpb.HealthClient, front pb.FrontClient) error {
+	ctx, cancel := context.WithTimeout(ctx, frontOptions.Timeout)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "x-request-id", "health-check")
+
+	reply, err := health.Check(ctx, &healthpb.HealthCheckRequest{})
+	if status.Code(err) == codes.Unimplemented {
+		mainLog.Debugf("%s does not implement the health service, sending a canary request.", target)
+		if _, err := front.ConvolutionalLayer(ctx, canaryRequest()); err != nil {
+			return fmt.Errorf("canary request to %s failed: %w", target, err)
+		}
+		mainLog.Printf("%s answered the canary request.", target)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("health check of %s failed: %w", target, err)
+	}
+	if reply.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("%s is %v", target, reply.GetStatus())
+	}
+	mainLog.Printf("%s is serving.", target)
+	return nil
+}
+
+// canaryRequest returns the smallest valid request, a 2x2 target with a single 1x1 kernel
+func canaryRequest() *pb.ConvolutionalLayerFrontRequest {
+	return &pb.ConvolutionalLayerFrontRequest{
+		Target:      utils.MatrixToProto([][]float32{{1, 1}, {1, 1}}),
+		Kernel:      []*pb.Matrix{utils.MatrixToProto([][]float32{{1}})},
+		AvgPoolSize: 1,
+		UseKernels:  true,
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// loadMatrixCSV reads a square matrix of float32 values from the CSV file at path
+func loadMatrixCSV(path string) ([][]float32, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%s: empty matrix", path)
+	}
+
+	matrix := make([][]float32, len(rows))
+	for i, row := range rows {
+		if len(row) != len(rows) {
+			return nil, fmt.Errorf("%s: matrix is not square, row %d has %d values for %d rows", path, i, len(row), len(rows))
+		}
+		matrix[i] = make([]float32, len(row))
+		for j, cell := range row {
+			value, err := strconv.ParseFloat(strings.TrimSpace(cell), 32)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid value at %d, %d: %w", path, i, j, err)
+			}
+			matrix[i][j] = float32(value)
+		}
+	}
+	return matrix, nil
+}
+
+// loadKernelDir reads every .csv file in dir, sorted by name, as a kernel of the same size
+func loadKernelDir(dir string) ([][][]float32, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.csv"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%s: no .csv files", dir)
+	}
+	sort.Strings(paths)
+
+	var kernels [][][]float32
+	for _, path := range paths {
+		kernel, err := loadMatrixCSV(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(kernels) > 0 && len(kernel) != len(kernels[0]) {
+			return nil, fmt.Errorf("%s: kernel is %dx%d, but %s is %dx%d",
+				path, len(kernel), len(kernel), paths[0], len(kernels[0]), len(kernels[0]))
+		}
+		kernels = append(kernels, kernel)
+	}
+	return kernels, nil
+}
+
+// loadMatrixPNG reads the PNG image at path as a grayscale matrix normalized to [0, 1],
+// center-cropping it to a square
+func loadMatrixPNG(path string) ([][]float32, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	// center-crop to the shorter side
+	bounds := img.Bounds()
+	size := min(bounds.Dx(), bounds.Dy())
+	origin := image.Pt(bounds.Min.X+(bounds.Dx()-size)/2, bounds.Min.Y+(bounds.Dy()-size)/2)
+
+	matrix := make([][]float32, size)
+	for i := 0; i < size; i++ {
+		matrix[i] = make([]float32, size)
+		for j := 0; j < size; j++ {
+			gray := color.Gray16Model.Convert(img.At(origin.X+j, origin.Y+i)).(color.Gray16)
+			matrix[i][j] = float32(gray.Y) / 0xffff
+		}
+	}
+	return matrix, nil
+}
+
+// generateMatrix is utils.GenerateMatrix drawing the random values from rng
+func generateMatrix(rng *rand.Rand, height int, width int, random bool, value float32) [][]float32 {
+	result := make([][]float32, height)
+	for i := 0; i < height; i++ {
+		result[i] = make([]float32, width)
+		for j := 0; j < width; j++ {
+			if random {
+				result[i][j] = rng.Float32()*2 - 1
+			} else {
+				result[i][j] = value
+			}
+		}
+	}
+	return result
+}
+
+// distributedMatrix returns a size x size matrix of random values drawn from the uniform or normal distribution
+// of the given mean and standard deviation
+func distributedMatrix(rng *rand.Rand, size int, dist string, mean float64, stdDev float64) [][]float32 {
+	result := make([][]float32, size)
+	for i := 0; i < size; i++ {
+		result[i] = make([]float32, size)
+		for j := 0; j < size; j++ {
+			if dist == "normal" {
+				result[i][j] = float32(mean + rng.NormFloat64()*stdDev)
+			} else {
+				// the uniform distribution over [mean - a, mean + a] has standard deviation a / sqrt(3)
+				result[i][j] = float32(mean + float64(rng.Float32()*2-1)*stdDev*math.Sqrt(3))
+			}
+		}
+	}
+	return result
+}
+
+// clampMatrix clamps the values of matrix, in place, to [lo, hi]
+func clampMatrix(matrix [][]float32, lo float64, hi float64) {
+	for _, row := range matrix {
+		for j, value := range row {
+			row[j] = float32(math.Min(math.Max(float64(value), lo), hi))
+		}
+	}
+}
+
+// fillMatrix returns a size x size matrix filled as selected by fill: zeros, ones, random or manual
+func fillMatrix(rng *rand.Rand, fill string, name string, size int) ([][]float32, error) {
+	switch fill {
+	case "zeros":
+		return generateMatrix(rng, size, size, false, 0), nil
+	case "random":
+		return generateMatrix(rng, size, size, true, 0), nil
+	case "manual":
+		return promptMatrix(name, size)
+	}
+	return generateMatrix(rng, size, size, false, 1), nil
+}
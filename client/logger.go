@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+var (
+	mainLog    = newLogger("Main")
+	clientLog  = newLogger("Client")
+	metricsLog = newLogger("Metrics")
+	jsonLogs   bool
+	logFile    *os.File
+	logLevel   = levelInfo
+)
+
+// levels of the events, an event is printed if its level is at least logLevel
+const (
+	levelDebug = iota
+	levelInfo
+	levelQuiet
+)
+
+// logger prints the events of a component, as "[Component]: message" lines or JSON objects
+type logger struct {
+	component string
+	fields    map[string]any
+}
+
+func newLogger(component string) logger {
+	return logger{component: component}
+}
+
+// with returns a copy of l adding key to the fields of the JSON events
+func (l logger) with(key string, value any) logger {
+	fields := make(map[string]any, len(l.fields)+1)
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	fields[key] = value
+	return logger{component: l.component, fields: fields}
+}
+
+func (l logger) output(level string, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if !jsonLogs {
+		log.Printf("[%s]: %s", l.component, msg)
+		return
+	}
+
+	event := make(map[string]any, len(l.fields)+4)
+	for k, v := range l.fields {
+		event[k] = v
+	}
+	event["time"] = time.Now().Format(time.RFC3339Nano)
+	event["level"] = level
+	event["component"] = l.component
+	event["message"] = msg
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(event); err != nil {
+		log.Printf(`{"level":"error","component":%q,"message":"could not encode log event: %v"}`, l.component, err)
+		return
+	}
+	log.Print(buf.String())
+}
+
+// Debugf logs a detailed event, printed only at the debug level
+func (l logger) Debugf(format string, args ...any) {
+	if logLevel <= levelDebug {
+		l.output("debug", format, args...)
+	}
+}
+
+// Printf logs an informational event, hidden at the quiet level
+func (l logger) Printf(format string, args ...any) {
+	if logLevel <= levelInfo {
+		l.output("info", format, args...)
+	}
+}
+
+// Summaryf logs an informational event of the final report, printed at every level
+func (l logger) Summaryf(format string, args ...any) {
+	l.output("info", format, args...)
+}
+
+// Errorf logs an error event, printed at every level
+func (l logger) Errorf(format string, args ...any) {
+	l.output("error", format, args...)
+}
+
+// setupLogFormat selects the output of the loggers, text or json
+func setupLogFormat(format string) error {
+	switch format {
+	case "text":
+		jsonLogs = false
+		log.SetFlags(log.LstdFlags)
+	case "json":
+		jsonLogs = true
+		log.SetFlags(0)
+	default:
+		return fmt.Errorf("unknown log format: %s", format)
+	}
+	return nil
+}
+
+// setupLogLevel selects the events printed by the loggers, quiet, info or debug
+func setupLogLevel(level string) error {
+	switch level {
+	case "quiet":
+		logLevel = levelQuiet
+	case "info":
+		logLevel = levelInfo
+	case "debug":
+		logLevel = levelDebug
+	default:
+		return fmt.Errorf("unknown log level: %s", level)
+	}
+	return nil
+}
+
+// setupLogFile writes the logs to the file at path, created or truncated, and to stdout as well with tee
+func setupLogFile(path string, tee bool) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	logFile = f
+	if tee {
+		log.SetOutput(io.MultiWriter(os.Stdout, f))
+	} else {
+		log.SetOutput(f)
+	}
+	return nil
+}
+
+// closeLogFile flushes and closes the log file, the later events are printed to stdout
+func closeLogFile() {
+	if logFile == nil {
+		return
+	}
+	log.SetOutput(os.Stdout)
+	logFile.Sync()
+	logFile.Close()
+	logFile = nil
+}
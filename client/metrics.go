@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sdcc_client_requests_total",
+		Help: "The number of completed requests by gRPC status code, or ClientError.",
+	}, []string{"status"})
+	requestDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "sdcc_client_request_duration_seconds",
+		Help:    "The latency of the successful requests.",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 14),
+	})
+	requestsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sdcc_client_requests_in_flight",
+		Help: "The number of requests currently in flight.",
+	})
+	metricsServer *http.Server
+)
+
+// startMetricsServer exposes the metrics on addr until stopMetricsServer
+func startMetricsServer(addr string) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(requestsTotal, requestDuration, requestsInFlight)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	metricsServer = &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			metricsLog.Errorf("Could not serve metrics on %s. More:\n%v", addr, err)
+		}
+	}()
+	metricsLog.Printf("Serving metrics on %s/metrics.", addr)
+}
+
+// stopMetricsServer shuts the metrics server down, if started
+func stopMetricsServer() {
+	if metricsServer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	metricsServer.Shutdown(ctx)
+	metricsServer = nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	npyMagic       = []byte("\x93NUMPY")
+	npyDescr       = regexp.MustCompile(`'descr':\s*'([^']*)'`)
+	npyFortran     = regexp.MustCompile(`'fortran_order':\s*(True|False)`)
+	npyShape       = regexp.MustCompile(`'shape':\s*\(([^)]*)\)`)
+	npyShapeFields = regexp.MustCompile(`\d+`)
+)
+
+// readNpy reads an array in the NumPy .npy format, of size bytes, which must hold little-endian float32 values in C order
+func readNpy(r io.Reader, size int64) ([]int, []float32, error) {
+	magic := make([]byte, len(npyMagic)+2)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, nil, fmt.Errorf("not a .npy array: %w", err)
+	}
+	if !bytes.Equal(magic[:len(npyMagic)], npyMagic) {
+		return nil, nil, fmt.Errorf("not a .npy array")
+	}
+
+	// version 1 has a 2-byte header length, the later versions a 4-byte one
+	var headerLen uint32
+	remaining := size - int64(len(magic))
+	if major := magic[len(npyMagic)]; major == 1 {
+		var short uint16
+		if err := binary.Read(r, binary.LittleEndian, &short); err != nil {
+			return nil, nil, err
+		}
+		headerLen = uint32(short)
+		remaining -= 2
+	} else if err := binary.Read(r, binary.LittleEndian, &headerLen); err != nil {
+		return nil, nil, err
+	} else {
+		remaining -= 4
+	}
+	// the lengths come from the file, they are checked against its size before allocating
+	if int64(headerLen) > remaining {
+		return nil, nil, fmt.Errorf("header of %d bytes, larger than the file", headerLen)
+	}
+	remaining -= int64(headerLen)
+	header := make([]byte, headerLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, err
+	}
+
+	descr := npyDescr.FindSubmatch(header)
+	if descr == nil || string(descr[1]) != "<f4" {
+		return nil, nil, fmt.Errorf("dtype must be little-endian float32 (<f4), header: %s", strings.TrimSpace(string(header)))
+	}
+	if fortran := npyFortran.FindSubmatch(header); fortran == nil || string(fortran[1]) != "False" {
+		return nil, nil, fmt.Errorf("array must be in C order, header: %s", strings.TrimSpace(string(header)))
+	}
+	shapeMatch := npyShape.FindSubmatch(header)
+	if shapeMatch == nil {
+		return nil, nil, fmt.Errorf("no shape in header: %s", strings.TrimSpace(string(header)))
+	}
+	var shape []int
+	count := int64(1)
+	for _, field := range npyShapeFields.FindAll(shapeMatch[1], -1) {
+		n, err := strconv.ParseInt(string(field), 10, 64)
+		if err != nil || (n > 0 && count > remaining/4/n) {
+			return nil, nil, fmt.Errorf("shape (%s) has more values than the %d bytes of data", shapeMatch[1], remaining)
+		}
+		shape = append(shape, int(n))
+		count *= n
+	}
+	if count*4 != remaining {
+		return nil, nil, fmt.Errorf("expected %d values, got %d bytes of data", count, remaining)
+	}
+
+	raw := make([]byte, count*4)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return nil, nil, fmt.Errorf("expected %d values: %w", count, err)
+	}
+	data := make([]float32, count)
+	for i := range data {
+		data[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw[i*4:]))
+	}
+	return shape, data, nil
+}
+
+// squareMatrices splits data, of shape (n, size, size), into n square matrices
+func squareMatrices(shape []int, data []float32) ([][][]float32, error) {
+	if len(shape) != 3 || shape[1] != shape[2] || shape[1] == 0 {
+		return nil, fmt.Errorf("shape is %v, expected (n, size, size)", shape)
+	}
+	size := shape[1]
+	matrices := make([][][]float32, shape[0])
+	for k := range matrices {
+		matrices[k] = make([][]float32, size)
+		for i := range matrices[k] {
+			start := (k*size + i) * size
+			matrices[k][i] = data[start : start+size]
+		}
+	}
+	return matrices, nil
+}
+
+// numpyArray converts an array to the target, of shape (size, size), or the kernels, of shape (n, size, size)
+func numpyArray(name string, shape []int, data []float32) ([][]float32, [][][]float32, error) {
+	switch name {
+	case "target":
+		if len(shape) != 2 {
+			return nil, nil, fmt.Errorf("target: shape is %v, expected (size, size)", shape)
+		}
+		matrices, err := squareMatrices(append([]int{1}, shape...), data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("target: %w", err)
+		}
+		return matrices[0], nil, nil
+	case "kernels":
+		matrices, err := squareMatrices(shape, data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("kernels: %w", err)
+		}
+		if len(matrices) == 0 {
+			return nil, nil, fmt.Errorf("kernels: no kernels")
+		}
+		return nil, matrices, nil
+	}
+	return nil, nil, fmt.Errorf("unknown array %s, expected target or kernels", name)
+}
+
+// loadNumpy reads the target and the kernels from the .npz archive at path, as the target and kernels arrays,
+// or either from the .npy file at path, as a 2-D target or a 3-D stack of kernels
+func loadNumpy(path string) ([][]float32, [][][]float32, error) {
+	if !strings.EqualFold(filepath.Ext(path), ".npz") {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return nil, nil, err
+		}
+		shape, data, err := readNpy(f, info.Size())
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", path, err)
+		}
+		name := "target"
+		if len(shape) == 3 {
+			name = "kernels"
+		}
+		target, kernels, err := numpyArray(name, shape, data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return target, kernels, nil
+	}
+
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer archive.Close()
+
+	var target [][]float32
+	var kernels [][][]float32
+	for _, file := range archive.File {
+		name := strings.TrimSuffix(file.Name, ".npy")
+		f, err := file.Open()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", path, err)
+		}
+		shape, data, err := readNpy(f, int64(file.UncompressedSize64))
+		f.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %s: %w", path, name, err)
+		}
+		t, k, err := numpyArray(name, shape, data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if t != nil {
+			target = t
+		} else {
+			kernels = k
+		}
+	}
+	if target == nil && kernels == nil {
+		return nil, nil, fmt.Errorf("%s: no target or kernels array", path)
+	}
+	return target, kernels, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// npyBytes encodes values as a version 1 .npy array with the given shape, as written in the header
+func npyBytes(shape string, values []float32) []byte {
+	header := []byte("{'descr': '<f4', 'fortran_order': False, 'shape': (" + shape + "), }\n")
+	var b bytes.Buffer
+	b.Write(npyMagic)
+	b.Write([]byte{1, 0})
+	binary.Write(&b, binary.LittleEndian, uint16(len(header)))
+	b.Write(header)
+	for _, v := range values {
+		binary.Write(&b, binary.LittleEndian, math.Float32bits(v))
+	}
+	return b.Bytes()
+}
+
+func TestReadNpy(t *testing.T) {
+	data := npyBytes("2, 2", []float32{1, 2, 3, 4})
+	shape, values, err := readNpy(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("readNpy failed: %v", err)
+	}
+	if !reflect.DeepEqual(shape, []int{2, 2}) || !reflect.DeepEqual(values, []float32{1, 2, 3, 4}) {
+		t.Errorf("got shape %v and values %v", shape, values)
+	}
+}
+
+func TestReadNpyRejectsCorruptHeaders(t *testing.T) {
+	tests := map[string][]byte{
+		// the shape alone would allocate terabytes, or overflow the size in bytes
+		"huge shape":         npyBytes("1000000, 1000000", []float32{1}),
+		"overflowing shape":  npyBytes("4611686018427387904, 4", []float32{1}),
+		"unparsable shape":   npyBytes("99999999999999999999", []float32{1}),
+		"truncated data":     npyBytes("2, 2", []float32{1, 2, 3}),
+		"trailing data":      npyBytes("2, 2", []float32{1, 2, 3, 4, 5}),
+		"header beyond file": npyBytes("2, 2", nil)[:12],
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := readNpy(bytes.NewReader(data), int64(len(data))); err == nil {
+				t.Error("readNpy succeeded")
+			}
+		})
+	}
+}
+
+func TestLoadNumpyRejectsHugeShape(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "target.npy")
+	if err := os.WriteFile(path, npyBytes("1000000, 1000000", []float32{1, 2, 3, 4}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := loadNumpy(path); err == nil {
+		t.Error("loadNumpy succeeded")
+	}
+}
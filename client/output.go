@@ -0,0 +1,438 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/gmarseglia/SDCC-Common/proto"
+	"github.com/gmarseglia/SDCC-Common/utils"
+)
+
+var (
+	csvFile    *os.File
+	csvWriter  *csv.Writer
+	outputLock sync.Mutex
+	records    []*RequestResult
+)
+
+// RunSummary is the machine-readable summary of a run
+type RunSummary struct {
+	Config   map[string]string `json:"config"`
+	Latency  LatencyStats      `json:"latency_ms"`
+	Requests []RequestSummary  `json:"requests"`
+	Totals   runTotals         `json:"totals"`
+	// Profiles breaks down the requests of a mixed workload by profile
+	Profiles []ProfileSummary `json:"profiles,omitempty"`
+}
+
+// LatencyStats holds the latency statistics in milliseconds
+type LatencyStats struct {
+	Count int     `json:"count"`
+	Min   float64 `json:"min"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P95   float64 `json:"p95"`
+	P99   float64 `json:"p99"`
+	Max   float64 `json:"max"`
+	// StdDev is in milliseconds as well, CV is a ratio
+	StdDev float64 `json:"stddev"`
+	CV     float64 `json:"cv"`
+}
+
+// RequestSummary is the machine-readable form of a RequestResult
+type RequestSummary struct {
+	ID          int     `json:"id"`
+	ServerID    int32   `json:"server_id"`
+	TargetSize  int     `json:"target_size"`
+	KernelNum   int     `json:"kernel_num"`
+	KernelSize  int     `json:"kernel_size"`
+	AvgPoolSize int     `json:"avg_pool_size"`
+	PayloadSize int     `json:"payload_size"`
+	LatencyMs   float64 `json:"latency_ms"`
+	Results     int     `json:"results"`
+	Error       string  `json:"error,omitempty"`
+	Profile     string  `json:"profile,omitempty"`
+}
+
+// RequestResult describes the outcome of a single measured request, as sent by convolutionalRun
+type RequestResult struct {
+	ID            int
+	Profile       string
+	ServerID      int32
+	TargetSize    int
+	KernelNum     int
+	KernelSize    int
+	AvgPoolSize   int
+	PayloadSize   int
+	BytesReceived int
+	Latency       time.Duration
+	Connect       time.Duration
+	Call          time.Duration
+	Results       int
+	Err           error
+}
+
+// collectResults consumes the results sent on the returned channel, feeding the statistics, the metrics and the outputs,
+// until the returned function is called, which returns once the results sent before are consumed
+func collectResults(capacity int) (chan<- *RequestResult, func()) {
+	results := make(chan *RequestResult, capacity)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// nil marks the end, the channel is not closed as abandoned requests may still send to it
+		for rec := range results {
+			if rec == nil {
+				return
+			}
+			collectResult(rec)
+		}
+	}()
+	return results, func() {
+		results <- nil
+		<-done
+	}
+}
+
+// collectResult adds rec to the statistics, the metrics and the outputs
+func collectResult(rec *RequestResult) {
+	requestsTotal.WithLabelValues(outcome(rec.Err)).Inc()
+	recordStatus(outcome(rec.Err))
+	if rec.Err == nil {
+		recordLatency(rec.Latency)
+		requestDuration.Observe(rec.Latency.Seconds())
+		recordBytes(rec.PayloadSize, rec.BytesReceived)
+		recordBreakdown(rec.Connect, rec.Call)
+	}
+	if rec.Profile != "" {
+		recordProfile(rec.Profile, rec.Latency, rec.Err)
+	}
+	recordRequest(rec)
+}
+
+// openCSV creates the CSV output at path and writes its header
+func openCSV(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	csvFile = f
+	csvWriter = csv.NewWriter(f)
+	return csvWriter.Write([]string{
+		"id", "server_id", "target_size", "kernel_num", "kernel_size", "avg_pool_size",
+		"payload_size", "latency_ms", "results", "status", "profile",
+	})
+}
+
+// recordRequest writes rec to the enabled outputs
+func recordRequest(rec *RequestResult) {
+	outputLock.Lock()
+	defer outputLock.Unlock()
+
+	// the records are only kept for the JSON summary and the ID map
+	if *JSONOut != "" || *PrintIDMap {
+		records = append(records, rec)
+	}
+
+	if csvWriter == nil {
+		return
+	}
+	status := "success"
+	if rec.Err != nil {
+		status = fmt.Sprintf("error: %v", rec.Err)
+	}
+	err := csvWriter.Write([]string{
+		strconv.Itoa(rec.ID),
+		strconv.Itoa(int(rec.ServerID)),
+		strconv.Itoa(rec.TargetSize),
+		strconv.Itoa(rec.KernelNum),
+		strconv.Itoa(rec.KernelSize),
+		strconv.Itoa(rec.AvgPoolSize),
+		strconv.Itoa(rec.PayloadSize),
+		strconv.FormatFloat(ms(rec.Latency), 'f', 3, 64),
+		strconv.Itoa(rec.Results),
+		status,
+		rec.Profile,
+	})
+	if err != nil {
+		mainLog.Errorf("Could not write CSV row for request #%d: %v", rec.ID, err)
+	}
+}
+
+// closeOutputs flushes and closes the enabled outputs
+func closeOutputs() {
+	outputLock.Lock()
+	defer outputLock.Unlock()
+
+	if csvWriter != nil {
+		csvWriter.Flush()
+		if err := csvWriter.Error(); err != nil {
+			mainLog.Errorf("Could not write CSV output: %v", err)
+		}
+		csvFile.Close()
+		csvWriter = nil
+	}
+}
+
+// resetRecords forgets the records kept so far
+func resetRecords() {
+	outputLock.Lock()
+	defer outputLock.Unlock()
+	records = nil
+}
+
+// printIDMap logs, for each measured request, the ID assigned by the server, its latency and its status,
+// to find the request in the logs of the server
+func printIDMap() {
+	outputLock.Lock()
+	sorted := slices.Clone(records)
+	outputLock.Unlock()
+	if len(sorted) == 0 {
+		return
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%8s %10s %12s  %s\n", "Request", "Server ID", "Latency (ms)", "Status")
+	for _, rec := range sorted {
+		serverID, latency := "-", "-"
+		if rec.Err == nil {
+			serverID, latency = strconv.Itoa(int(rec.ServerID)), strconv.FormatFloat(ms(rec.Latency), 'f', 2, 64)
+		}
+		fmt.Fprintf(&b, "%8d %10s %12s  %s\n", rec.ID, serverID, latency, outcome(rec.Err))
+	}
+	mainLog.Summaryf("Request IDs:\n%s", strings.TrimSuffix(b.String(), "\n"))
+}
+
+// latencyStats converts l to milliseconds
+func latencyStats(l latencySummary) LatencyStats {
+	return LatencyStats{
+		Count:  l.Count,
+		Min:    ms(l.Min),
+		Mean:   ms(l.Mean),
+		P50:    ms(l.P50),
+		P95:    ms(l.P95),
+		P99:    ms(l.P99),
+		Max:    ms(l.Max),
+		StdDev: ms(l.StdDev),
+		CV:     l.CV,
+	}
+}
+
+// writeJSONSummary writes the RunSummary of the run to path
+func writeJSONSummary(path string, wallClock time.Duration) error {
+	summary := RunSummary{
+		Config: map[string]string{},
+		Totals: currentTotals(wallClock),
+	}
+
+	// every flag, with the values resolved by setupFields
+	flag.VisitAll(func(f *flag.Flag) {
+		summary.Config[f.Name] = redactedValue(f)
+	})
+
+	summary.Latency = latencyStats(currentLatencySummary())
+	summary.Profiles = currentProfileSummaries()
+
+	outputLock.Lock()
+	for _, rec := range records {
+		r := RequestSummary{
+			ID:          rec.ID,
+			ServerID:    rec.ServerID,
+			TargetSize:  rec.TargetSize,
+			KernelNum:   rec.KernelNum,
+			KernelSize:  rec.KernelSize,
+			AvgPoolSize: rec.AvgPoolSize,
+			PayloadSize: rec.PayloadSize,
+			LatencyMs:   ms(rec.Latency),
+			Results:     rec.Results,
+			Profile:     rec.Profile,
+		}
+		if rec.Err != nil {
+			r.Error = rec.Err.Error()
+		}
+		summary.Requests = append(summary.Requests, r)
+	}
+	outputLock.Unlock()
+
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// matrixToImage maps the values of matrix linearly from [min, max] to a grayscale image
+func matrixToImage(matrix [][]float32) *image.Gray {
+	height := len(matrix)
+	width := 0
+	if height > 0 {
+		width = len(matrix[0])
+	}
+
+	lo, hi := float32(0), float32(0)
+	for i, row := range matrix {
+		for j, value := range row {
+			if (i == 0 && j == 0) || value < lo {
+				lo = value
+			}
+			if (i == 0 && j == 0) || value > hi {
+				hi = value
+			}
+		}
+	}
+
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i, row := range matrix {
+		for j, value := range row {
+			var level uint8
+			if hi > lo {
+				level = uint8((value - lo) / (hi - lo) * 255)
+			}
+			img.SetGray(j, i, color.Gray{Y: level})
+		}
+	}
+	return img
+}
+
+// writeResultImages writes each result of request id to dir as a PNG image
+func writeResultImages(dir string, id int, results []*pb.Matrix) error {
+	for index, result := range results {
+		path := filepath.Join(dir, fmt.Sprintf("req%d_result%d.png", id, index))
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		err = png.Encode(f, matrixToImage(utils.ProtoToMatrix(result)))
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// writeMatrixCSV writes matrix to the CSV file at path
+func writeMatrixCSV(path string, matrix [][]float32) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	for _, row := range matrix {
+		record := make([]string, len(row))
+		for j, value := range row {
+			record[j] = strconv.FormatFloat(float64(value), 'g', -1, 32)
+		}
+		if err := w.Write(record); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// writeResultCSVs writes each result of request id to dir as a CSV file
+func writeResultCSVs(dir string, id int, results []*pb.Matrix) error {
+	for index, result := range results {
+		path := filepath.Join(dir, fmt.Sprintf("req%d_result%d.csv", id, index))
+		if err := writeMatrixCSV(path, utils.ProtoToMatrix(result)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shownIndexes returns the indexes of the first and last of n rows or columns shown by prettyPrint,
+// -1 standing for the ellipsis, or all of them when maxShown is 0 or the ellipsis would hide a single one
+func shownIndexes(n int, maxShown int) []int {
+	if maxShown <= 0 || n <= maxShown+1 {
+		indexes := make([]int, n)
+		for i := range indexes {
+			indexes[i] = i
+		}
+		return indexes
+	}
+	head, tail := (maxShown+1)/2, maxShown/2
+	var indexes []int
+	for i := 0; i < head; i++ {
+		indexes = append(indexes, i)
+	}
+	indexes = append(indexes, -1)
+	for i := n - tail; i < n; i++ {
+		indexes = append(indexes, i)
+	}
+	return indexes
+}
+
+// prettyPrint prints matrix as utils.PrettyPrint, with precision decimal places,
+// showing at most maxShown rows and columns, 0 for all of them
+func prettyPrint(title string, matrix [][]float32, precision int, maxShown int) {
+	width := 0
+	if len(matrix) > 0 {
+		width = len(matrix[0])
+	}
+	rows, cols := shownIndexes(len(matrix), maxShown), shownIndexes(width, maxShown)
+
+	var b strings.Builder
+	b.WriteString(title)
+	if slices.Contains(rows, -1) || slices.Contains(cols, -1) {
+		fmt.Fprintf(&b, " (%dx%d)", len(matrix), width)
+	}
+	b.WriteString("\n")
+	for _, i := range rows {
+		for _, j := range cols {
+			if i == -1 || j == -1 {
+				b.WriteString("... ")
+			} else {
+				fmt.Fprintf(&b, "%.*f ", precision, matrix[i][j])
+			}
+		}
+		b.WriteString("\n")
+	}
+	// a single write, so that the matrices of concurrent requests do not interleave
+	fmt.Print(b.String())
+}
+
+// reduceMatrix reduces matrix to a scalar: its sum, mean, l2norm (Frobenius norm) or max
+func reduceMatrix(matrix [][]float32, reduction string) float64 {
+	var sum, squares float64
+	highest := math.Inf(-1)
+	count := 0
+	for _, row := range matrix {
+		for _, value := range row {
+			v := float64(value)
+			sum += v
+			squares += v * v
+			highest = math.Max(highest, v)
+			count++
+		}
+	}
+	switch reduction {
+	case "mean":
+		if count == 0 {
+			return 0
+		}
+		return sum / float64(count)
+	case "l2norm":
+		return math.Sqrt(squares)
+	case "max":
+		return highest
+	}
+	return sum
+}
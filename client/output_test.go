@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestShownIndexes(t *testing.T) {
+	tests := []struct {
+		n, maxShown int
+		want        []int
+	}{
+		{3, 0, []int{0, 1, 2}},
+		{3, 4, []int{0, 1, 2}},
+		{4, 4, []int{0, 1, 2, 3}},
+		// an ellipsis in place of a single index would save nothing
+		{5, 4, []int{0, 1, 2, 3, 4}},
+		{6, 4, []int{0, 1, -1, 4, 5}},
+		{7, 3, []int{0, 1, -1, 6}},
+	}
+	for _, tt := range tests {
+		if got := shownIndexes(tt.n, tt.maxShown); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("shownIndexes(%d, %d) = %v, expected %v", tt.n, tt.maxShown, got, tt.want)
+		}
+	}
+}
+
+// capturePrint returns what print writes to the standard output
+func capturePrint(t *testing.T, print func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	print()
+	os.Stdout = stdout
+	w.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+// square returns an n x n matrix of ones
+func square(n int) [][]float32 {
+	matrix := make([][]float32, n)
+	for i := range matrix {
+		matrix[i] = make([]float32, n)
+		for j := range matrix[i] {
+			matrix[i][j] = 1
+		}
+	}
+	return matrix
+}
+
+func TestPrettyPrintLabel(t *testing.T) {
+	tests := []struct {
+		n, maxShown int
+		wantLabel   bool
+	}{
+		{4, 0, false},
+		{4, 4, false},
+		{5, 4, false},
+		{6, 4, true},
+	}
+	for _, tt := range tests {
+		out := capturePrint(t, func() { prettyPrint("Result", square(tt.n), 1, tt.maxShown) })
+		lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+		hasLabel := strings.HasPrefix(lines[0], "Result (")
+		hasEllipsis := strings.Contains(out, "...")
+		if hasLabel != tt.wantLabel || hasEllipsis != tt.wantLabel {
+			t.Errorf("%dx%d, at most %d shown: got label %v and ellipsis %v, expected %v:\n%s", tt.n, tt.n, tt.maxShown, hasLabel, hasEllipsis, tt.wantLabel, out)
+		}
+		if !tt.wantLabel && len(lines) != tt.n+1 {
+			t.Errorf("%dx%d, at most %d shown: got %d rows, expected all of them", tt.n, tt.n, tt.maxShown, len(lines)-1)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"sync"
+
+	"google.golang.org/grpc"
+)
+
+// pool holds every connection of the run, to the front service and to the compared one, nil before connect
+var pool *connPool
+
+// connPool dials and caches the connections by key, sharing them between all the goroutines,
+// so that a connection is dialed once and reused for the whole run, across the sizes of a sweep
+type connPool struct {
+	lock   sync.Mutex
+	opts   []grpc.DialOption
+	conns  map[string]*grpc.ClientConn
+	closed bool
+}
+
+// newConnPool returns an empty pool dialing its connections with opts
+func newConnPool(opts ...grpc.DialOption) *connPool {
+	return &connPool{opts: opts, conns: map[string]*grpc.ClientConn{}}
+}
+
+// get returns the connection cached as key, creating it to target with the options of the pool and extra
+// on the first call. The key tells apart the connections to the same target, as with Connections above 1
+func (p *connPool) get(key string, target string, extra ...grpc.DialOption) (*grpc.ClientConn, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.closed {
+		return nil, errors.New("connection pool closed")
+	}
+	if conn, ok := p.conns[key]; ok {
+		return conn, nil
+	}
+
+	// copy the options, so that the extra options of a connection do not leak into the others
+	opts := append(append([]grpc.DialOption{}, p.opts...), extra...)
+	conn, err := grpc.NewClient(target, opts...)
+	if err != nil {
+		return nil, err
+	}
+	p.conns[key] = conn
+	return conn, nil
+}
+
+// close closes every connection of the pool, the later calls to get failing
+func (p *connPool) close() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for key, conn := range p.conns {
+		conn.Close()
+		delete(p.conns, key)
+	}
+	p.closed = true
+}
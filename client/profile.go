@@ -0,0 +1,216 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"client/client"
+)
+
+// requestProfile is a named request shape of a mixed workload, the requests drawing their profile by weight
+type requestProfile struct {
+	name        string
+	targetSize  int
+	kernelNum   int
+	kernelSize  int
+	avgPoolSize int
+	weight      float64
+}
+
+// the profiles of a mixed workload, in the order given, nil without Profile
+var profiles []requestProfile
+
+// profileList is the value of Profile, which can be repeated, each value holding one or more profiles separated by ;
+type profileList []string
+
+func (l *profileList) String() string {
+	return strings.Join(*l, ";")
+}
+
+func (l *profileList) Set(value string) error {
+	for _, spec := range strings.Split(value, ";") {
+		if spec = strings.TrimSpace(spec); spec != "" {
+			*l = append(*l, spec)
+		}
+	}
+	return nil
+}
+
+func (l *profileList) Get() any {
+	return l.String()
+}
+
+// profileFlag defines a repeatable flag of profiles, as flag.String defines the others
+func profileFlag(name string, usage string) *profileList {
+	l := &profileList{}
+	flag.Var(l, name, usage)
+	return l
+}
+
+// parseProfile parses a profile such as small:targetSize=100,kernelNum=10,weight=3, the settings not given
+// being those of the flags
+func parseProfile(spec string) (requestProfile, error) {
+	name, settings, _ := strings.Cut(spec, ":")
+	p := requestProfile{strings.TrimSpace(name), *TargetSize, *KernelNum, *KernelSize, *AvgPoolSize, 1}
+	if p.name == "" || strings.ContainsAny(p.name, " ,=") {
+		return p, fmt.Errorf("%q: the name must not be empty, nor contain spaces, commas or =", spec)
+	}
+
+	for _, setting := range strings.Split(settings, ",") {
+		if strings.TrimSpace(setting) == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(setting, "=")
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		if key == "weight" {
+			weight, err := strconv.ParseFloat(value, 64)
+			if err != nil || weight <= 0 {
+				return p, fmt.Errorf("%s: weight must be a positive number, got: %q", p.name, value)
+			}
+			p.weight = weight
+			continue
+		}
+
+		fields := map[string]*int{"targetsize": &p.targetSize, "kernelnum": &p.kernelNum, "kernelsize": &p.kernelSize, "avgpoolsize": &p.avgPoolSize}
+		field, ok := fields[key]
+		if !ok {
+			return p, fmt.Errorf("%s: unknown setting %q, must be one of: targetSize, kernelNum, kernelSize, avgPoolSize, weight", p.name, key)
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || (n == 0 && key != "kernelsize") {
+			return p, fmt.Errorf("%s: %s must be a positive integer, got: %q", p.name, key, value)
+		}
+		*field = n
+	}
+
+	if err := client.ValidateParams(p.targetSize, p.kernelSize, p.kernelSize > 0); err != nil {
+		return p, fmt.Errorf("%s: %w", p.name, err)
+	}
+	return p, nil
+}
+
+// setupProfiles parses the profiles of Profile, after the flags they default to
+func setupProfiles() {
+	if len(*Profile) == 0 {
+		return
+	}
+	// the profiles replace the sizes of the requests, which the inputs and the sweep set as well
+	if targetMatrix != nil || kernelMatrices != nil {
+		mainLog.Errorf("Profile cannot be given with the inputs of TargetFile, TargetImage, NumpyFile or KernelDir.")
+		exit(1)
+	}
+	if replayRequests != nil || sweepSizes != nil {
+		mainLog.Errorf("Profile cannot be given with ReplayRequests or SizeSweep.")
+		exit(1)
+	}
+
+	names := map[string]bool{}
+	for _, spec := range *Profile {
+		p, err := parseProfile(spec)
+		if err != nil {
+			mainLog.Errorf("Profile must be given as name:key=value,..., with the keys targetSize, kernelNum, kernelSize, avgPoolSize and weight. More:\n%v", err)
+			exit(1)
+		}
+		if names[p.name] {
+			mainLog.Errorf("Profile %s is given twice.", p.name)
+			exit(1)
+		}
+		names[p.name] = true
+		profiles = append(profiles, p)
+	}
+}
+
+// chooseProfile returns the profile of the request id, drawn by weight from Seed and the id only,
+// so that a run with the same Seed sends the same mix
+func chooseProfile(id int) *requestProfile {
+	total := 0.0
+	for _, p := range profiles {
+		total += p.weight
+	}
+	draw := idFraction("profile", id) * total
+	for i := range profiles {
+		if draw < profiles[i].weight {
+			return &profiles[i]
+		}
+		draw -= profiles[i].weight
+	}
+	// the rounding of the weights can leave a remainder
+	return &profiles[len(profiles)-1]
+}
+
+// profileTally holds the outcome of the measured requests of a profile
+type profileTally struct {
+	succeeded int
+	failed    int
+	latencies []time.Duration
+}
+
+// profileTallies are keyed by profile name, guarded by latenciesLock
+var profileTallies = map[string]*profileTally{}
+
+// recordProfile adds the outcome of a measured request of profile to its statistics
+func recordProfile(profile string, latency time.Duration, err error) {
+	latenciesLock.Lock()
+	defer latenciesLock.Unlock()
+	tally, ok := profileTallies[profile]
+	if !ok {
+		tally = &profileTally{}
+		profileTallies[profile] = tally
+	}
+	if err != nil {
+		tally.failed++
+		return
+	}
+	tally.succeeded++
+	tally.latencies = append(tally.latencies, latency)
+}
+
+// ProfileSummary is the machine-readable outcome of the requests of a profile
+type ProfileSummary struct {
+	Name      string       `json:"name"`
+	Weight    float64      `json:"weight"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Latency   LatencyStats `json:"latency_ms"`
+}
+
+// currentProfileSummaries returns the outcome of the requests of each profile so far, in the order given
+func currentProfileSummaries() []ProfileSummary {
+	latenciesLock.Lock()
+	defer latenciesLock.Unlock()
+	var summaries []ProfileSummary
+	for _, p := range profiles {
+		s := ProfileSummary{Name: p.name, Weight: p.weight}
+		if tally, ok := profileTallies[p.name]; ok {
+			s.Succeeded, s.Failed = tally.succeeded, tally.failed
+			s.Latency = latencyStats(summarizeLatencies(tally.latencies))
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries
+}
+
+// printProfiles logs the outcome and the latency statistics of the requests of each profile
+func printProfiles() {
+	summaries := currentProfileSummaries()
+	if len(summaries) == 0 {
+		return
+	}
+	sent := 0
+	for _, s := range summaries {
+		sent += s.Succeeded + s.Failed
+	}
+	mainLog.Summaryf("Latency by profile:")
+	for _, s := range summaries {
+		share := 0.0
+		if sent > 0 {
+			share = float64(s.Succeeded+s.Failed) / float64(sent) * 100
+		}
+		l := s.Latency
+		mainLog.Summaryf("Profile %s, weight %g, %.1f%% of the requests. Succeeded: %d, Failed: %d. Latency (ms). Avg: %.2f, P50: %.2f, P95: %.2f, P99: %.2f, Max: %.2f.",
+			s.Name, s.Weight, share, s.Succeeded, s.Failed, l.Mean, l.P50, l.P95, l.P99, l.Max)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	progressWidth    = 30
+	progressInterval = 100 * time.Millisecond
+)
+
+// bar is nil when the progress bar is disabled
+var bar *progressBar
+
+// progressBar renders the completed requests of the run on a single terminal line
+type progressBar struct {
+	total int
+	start time.Time
+	last  time.Time
+	lock  sync.Mutex
+}
+
+// newProgressBar returns a bar for total requests, or for an unknown number if total is 0
+func newProgressBar(total int) *progressBar {
+	return &progressBar{total: total, start: time.Now()}
+}
+
+// isTerminal reports whether f is a character device, as a terminal is
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// update redraws the bar, at most once per progressInterval unless the run is complete
+func (p *progressBar) update(done int, failed int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := time.Now()
+	if now.Sub(p.last) < progressInterval && done != p.total {
+		return
+	}
+	p.last = now
+
+	success := 0.0
+	if done > 0 {
+		success = float64(done-failed) / float64(done) * 100
+	}
+	elapsed := now.Sub(p.start)
+
+	// without a total, as in duration mode, only the count is known
+	if p.total <= 0 {
+		fmt.Fprintf(os.Stdout, "\r%d completed, elapsed %v, success %.1f%%", done, elapsed.Round(time.Second), success)
+		return
+	}
+
+	filled := min(done*progressWidth/p.total, progressWidth)
+	eta := "?"
+	if done > 0 {
+		remaining := time.Duration(float64(elapsed) / float64(done) * float64(p.total-done))
+		eta = remaining.Round(time.Second).String()
+	}
+	fmt.Fprintf(os.Stdout, "\r[%s%s] %d/%d %3d%%, ETA %s, success %.1f%%",
+		strings.Repeat("#", filled), strings.Repeat("-", progressWidth-filled),
+		done, p.total, done*100/p.total, eta, success)
+}
+
+// finish ends the line of the bar, so that the following logs start on a new line
+func (p *progressBar) finish() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	fmt.Fprintln(os.Stdout)
+}
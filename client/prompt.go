@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// a single reader, so that input buffered for a matrix is not lost for the next one
+	stdin     = bufio.NewReader(os.Stdin)
+	stdinLock sync.Mutex
+)
+
+// promptMatrix reads a size x size matrix from stdin, as values separated by spaces, commas or newlines,
+// or as the path of a CSV file, prompting again on malformed input
+func promptMatrix(name string, size int) ([][]float32, error) {
+	// concurrent requests prompt one at a time
+	stdinLock.Lock()
+	defer stdinLock.Unlock()
+
+	for {
+		fmt.Printf("Enter the %d values of %s (%dx%d), row by row, or the path of a CSV file:\n", size*size, name, size, size)
+		matrix, err := readMatrix(size)
+		if err == nil {
+			return matrix, nil
+		}
+		var invalid invalidInputError
+		if !errors.As(err, &invalid) {
+			return nil, err
+		}
+		fmt.Printf("%v. Enter %s again.\n", err, name)
+	}
+}
+
+// invalidInputError is returned by readMatrix for input that can be entered again
+type invalidInputError struct {
+	reason string
+}
+
+func (e invalidInputError) Error() string {
+	return e.reason
+}
+
+// readMatrix reads lines until size*size values are given, or a CSV path as the first line
+func readMatrix(size int) ([][]float32, error) {
+	values := make([]float32, 0, size*size)
+	for len(values) < size*size {
+		if len(values) > 0 {
+			fmt.Printf("%d of %d values, continue: ", len(values), size*size)
+		}
+		line, err := stdin.ReadString('\n')
+		if err != nil && line == "" {
+			return nil, fmt.Errorf("could not read stdin: %w", err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		// a path is accepted only in place of the whole matrix
+		if len(values) == 0 && strings.HasSuffix(strings.ToLower(line), ".csv") {
+			matrix, err := loadMatrixCSV(line)
+			if err != nil {
+				return nil, invalidInputError{err.Error()}
+			}
+			if len(matrix) != size {
+				return nil, invalidInputError{fmt.Sprintf("%s is %dx%d, expected %dx%d", line, len(matrix), len(matrix), size, size)}
+			}
+			return matrix, nil
+		}
+
+		for _, field := range strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+			value, err := strconv.ParseFloat(field, 32)
+			if err != nil {
+				return nil, invalidInputError{fmt.Sprintf("invalid value %q", field)}
+			}
+			values = append(values, float32(value))
+		}
+		if len(values) > size*size {
+			return nil, invalidInputError{fmt.Sprintf("%d values given, expected %d", len(values), size*size)}
+		}
+	}
+
+	matrix := make([][]float32, size)
+	for i := range matrix {
+		matrix[i] = values[i*size : (i+1)*size]
+	}
+	return matrix, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/gmarseglia/SDCC-Common/proto"
+)
+
+var (
+	recordFile     *os.File
+	recordWriter   *bufio.Writer
+	recordLock     sync.Mutex
+	replayRequests []*pb.ConvolutionalLayerFrontRequest
+)
+
+// openRecord creates the request log at path
+func openRecord(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	recordFile = f
+	recordWriter = bufio.NewWriter(f)
+	return nil
+}
+
+// recordFrontRequest appends request to the request log, prefixed by its size as a varint
+func recordFrontRequest(request *pb.ConvolutionalLayerFrontRequest) error {
+	recordLock.Lock()
+	defer recordLock.Unlock()
+	if recordWriter == nil {
+		return errors.New("request log closed")
+	}
+	_, err := protodelim.MarshalTo(recordWriter, request)
+	return err
+}
+
+// closeRecord flushes and closes the request log
+func closeRecord() {
+	recordLock.Lock()
+	defer recordLock.Unlock()
+
+	if recordWriter != nil {
+		if err := recordWriter.Flush(); err != nil {
+			mainLog.Errorf("Could not write the request log: %v", err)
+		}
+		recordFile.Close()
+		recordWriter = nil
+	}
+}
+
+// loadReplay reads every request of the request log at path, in the order they were recorded
+func loadReplay(path string) ([]*pb.ConvolutionalLayerFrontRequest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// the requests can be as large as MaxMsgSize
+	options := protodelim.UnmarshalOptions{MaxSize: -1}
+	r := bufio.NewReader(f)
+	var requests []*pb.ConvolutionalLayerFrontRequest
+	for {
+		request := &pb.ConvolutionalLayerFrontRequest{}
+		if err := options.UnmarshalFrom(r, request); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: request %d: %w", path, len(requests)+1, err)
+		}
+		rows := request.GetTarget().GetRows()
+		if len(rows) == 0 || slices.ContainsFunc(rows, func(row *pb.Row) bool { return len(row.GetValues()) != len(rows) }) {
+			return nil, fmt.Errorf("%s: request %d: target is not a non-empty square matrix", path, len(requests)+1)
+		}
+		if request.GetAvgPoolSize() <= 0 {
+			return nil, fmt.Errorf("%s: request %d: AvgPoolSize must be positive, got %d", path, len(requests)+1, request.GetAvgPoolSize())
+		}
+		requests = append(requests, request)
+	}
+	if len(requests) == 0 {
+		return nil, fmt.Errorf("%s: no requests", path)
+	}
+	return requests, nil
+}
+
+// replayedRequest returns a copy of the recorded request sent as request id, starting again at the first one
+// when there are more requests than recorded
+func replayedRequest(id int) *pb.ConvolutionalLayerFrontRequest {
+	// the calls in progress are told apart by their messages, see timedCodec
+	return proto.Clone(replayRequests[(id-1)%len(replayRequests)]).(*pb.ConvolutionalLayerFrontRequest)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protodelim"
+
+	pb "github.com/gmarseglia/SDCC-Common/proto"
+)
+
+func TestLoadReplayRejectsZeroAvgPoolSize(t *testing.T) {
+	target := &pb.Matrix{Rows: []*pb.Row{{Values: []float32{1}}}}
+	var buf bytes.Buffer
+	for _, avgPoolSize := range []int32{1, 0} {
+		if _, err := protodelim.MarshalTo(&buf, &pb.ConvolutionalLayerFrontRequest{Target: target, AvgPoolSize: avgPoolSize}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "requests.bin")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadReplay(path); err == nil || !strings.Contains(err.Error(), "request 2: AvgPoolSize") {
+		t.Errorf("got %v, expected the second request rejected", err)
+	}
+}
+
+func TestLoadReplayRejectsRaggedTarget(t *testing.T) {
+	ragged := &pb.Matrix{Rows: []*pb.Row{{Values: []float32{1, 2}}, {Values: []float32{3}}}}
+	var buf bytes.Buffer
+	if _, err := protodelim.MarshalTo(&buf, &pb.ConvolutionalLayerFrontRequest{Target: ragged, AvgPoolSize: 1}); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "requests.bin")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadReplay(path); err == nil || !strings.Contains(err.Error(), "not a non-empty square matrix") {
+		t.Errorf("got %v, expected the ragged target rejected", err)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/gmarseglia/SDCC-Common/proto"
+)
+
+// retryBudgetReserve is the number of retries allowed by the budget regardless of the attempts,
+// so that the first failures of a run can be retried
+const retryBudgetReserve = 10
+
+var (
+	attemptCount    atomic.Int64
+	retryCount      atomic.Int64
+	budgetExhausted atomic.Bool
+)
+
+// parseRetryBudget parses a fraction of the attempts, as 0.2 or 20%
+func parseRetryBudget(value string) (float64, error) {
+	percent, isPercent := strings.CutSuffix(value, "%")
+	budget, err := strconv.ParseFloat(percent, 64)
+	if err != nil {
+		return 0, err
+	}
+	if isPercent {
+		budget /= 100
+	}
+	if budget < 0 || budget > 1 {
+		return 0, fmt.Errorf("%s is not between 0 and 100%%", value)
+	}
+	return budget, nil
+}
+
+// takeRetry reports whether the retry budget, if any, allows one more retry, and takes it
+func takeRetry(clog logger) bool {
+	if retryBudget < 0 {
+		retryCount.Add(1)
+		return true
+	}
+	for {
+		// the retry counts as an attempt as well
+		retries := retryCount.Load()
+		if float64(retries+1) > retryBudget*float64(attemptCount.Load()+1)+retryBudgetReserve {
+			if budgetExhausted.CompareAndSwap(false, true) {
+				clog.Errorf("Retry budget exhausted after %d retries of %d attempts, failing the retriable errors immediately.",
+					retries, attemptCount.Load())
+			}
+			return false
+		}
+		if retryCount.CompareAndSwap(retries, retries+1) {
+			return true
+		}
+	}
+}
+
+// failedRequest holds what is needed to send a failed request again
+type failedRequest struct {
+	id        int
+	name      string
+	requestID string
+	request   *pb.ConvolutionalLayerFrontRequest
+	target    [][]float32
+	err       error
+}
+
+var (
+	failedRequests []failedRequest
+	failedLock     sync.Mutex
+)
+
+// recordFailed keeps a measured request that failed, to send it again with resendFailed
+func recordFailed(f failedRequest) {
+	failedLock.Lock()
+	defer failedLock.Unlock()
+	failedRequests = append(failedRequests, f)
+}
+
+// resendFailed sends the failed requests again, one at a time, in rounds up to MaxRetries, at least one,
+// and returns the number of requests still failing
+func resendFailed() int {
+	failedLock.Lock()
+	pending := failedRequests
+	failedRequests = nil
+	failedLock.Unlock()
+	if len(pending) == 0 {
+		return 0
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].id < pending[j].id })
+
+	rounds := max(*MaxRetries, 1)
+	mainLog.Printf("Sending %d failed requests again, up to %d times...", len(pending), rounds)
+	for round := 1; round <= rounds && len(pending) > 0; round++ {
+		// wait between the rounds, as between the attempts of a request
+		select {
+		case <-time.After(frontOptions.Backoff.Delay(round - 1)):
+		case <-rootCtx.Done():
+			return len(pending)
+		}
+
+		var still []failedRequest
+		for _, f := range pending {
+			clog := clientLog.with("request_id", f.id).with("retry_round", round)
+			requestID := fmt.Sprintf("%s-retry%d", f.requestID, round)
+			// a single attempt, the rounds being the retries
+			c, _ := newFrontClient(clog, f.name, roundRobinFront{}, 0)
+			var r *pb.ConvolutionalLayerFrontReply
+			if r, _, f.err = c.Send(rootCtx, requestID, f.request); f.err != nil {
+				logUnsuccessful(clog, f.name, f.err)
+			}
+			if f.err == nil {
+				f.err = checkResults(clog, f.name, f.id, f.target, f.request, r.GetResult())
+			}
+			if f.err == nil && compareClient != nil {
+				f.err = compareRun(rootCtx, clog, f.name, requestID, f.request, r.GetResult())
+			}
+			if f.err != nil {
+				still = append(still, f)
+				continue
+			}
+			if *PrintChecksum || *ExpectChecksum != "" {
+				recordChecksum(f.id, r.GetResult())
+			}
+			mainLog.Summaryf("%s succeeded when sent again, round %d.", f.name, round)
+		}
+		pending = still
+	}
+
+	for _, f := range pending {
+		mainLog.Errorf("%s still failing after %d rounds. More:\n%v", f.name, rounds, f.err)
+	}
+	return len(pending)
+}
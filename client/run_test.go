@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/gmarseglia/SDCC-Common/proto"
+
+	"client/client"
+)
+
+// testFlags are the flags of the test runs: small requests, to the fronts given by the test, without waiting for them
+var testFlags = []string{
+	"-FrontAddr", "test", "-TargetSize", "8", "-KernelNum", "2", "-KernelSize", "3", "-AvgPoolSize", "2",
+	"-HealthCheck=false", "-WaitForReady=false", "-LogLevel", "quiet",
+}
+
+// frontFunc is a front service replying with its function
+type frontFunc func(ctx context.Context, in *pb.ConvolutionalLayerFrontRequest) (*pb.ConvolutionalLayerFrontReply, error)
+
+func (f frontFunc) ConvolutionalLayer(ctx context.Context, in *pb.ConvolutionalLayerFrontRequest, _ ...grpc.CallOption) (*pb.ConvolutionalLayerFrontReply, error) {
+	return f(ctx, in)
+}
+
+// okReply replies with a result of the expected shape per kernel
+func okReply(_ context.Context, in *pb.ConvolutionalLayerFrontRequest) (*pb.ConvolutionalLayerFrontReply, error) {
+	size := (len(in.Target.Rows) - len(in.Kernel[0].Rows) + int(in.AvgPoolSize)) / int(in.AvgPoolSize)
+	reply := &pb.ConvolutionalLayerFrontReply{ID: 1}
+	for range in.Kernel {
+		result := &pb.Matrix{}
+		for i := 0; i < size; i++ {
+			result.Rows = append(result.Rows, &pb.Row{Values: make([]float32, size)})
+		}
+		reply.Result = append(reply.Result, result)
+	}
+	return reply, nil
+}
+
+// setupRun sets up a run from testFlags then args, sending the requests with fronts in turn, and returns its logs.
+// The flags, the clients and the statistics are restored after the test
+func setupRun(t testing.TB, fronts []pb.FrontClient, args ...string) *bytes.Buffer {
+	t.Helper()
+	saved := map[string]string{}
+	flag.VisitAll(func(f *flag.Flag) {
+		if !strings.HasPrefix(f.Name, "test.") {
+			saved[f.Name] = f.Value.String()
+		}
+	})
+	logs := &bytes.Buffer{}
+	log.SetOutput(logs)
+	t.Cleanup(func() {
+		log.SetOutput(os.Stdout)
+		for name, value := range saved {
+			flag.Set(name, value)
+		}
+		clients = nil
+		resetCounters()
+	})
+
+	if err := flag.CommandLine.Parse(append(append([]string{}, testFlags...), args...)); err != nil {
+		t.Fatal(err)
+	}
+	setupFields()
+	rootCtx, rootCancel = context.WithCancel(context.Background())
+	t.Cleanup(rootCancel)
+	clients = fronts
+	return logs
+}
+
+// sendRequests sends count requests, at most concurrency at once, and returns their records
+func sendRequests(count int, concurrency int) []*RequestResult {
+	results := make(chan *RequestResult, count)
+	d := newDispatcher(concurrency, 0, 0, 0)
+	for i := 0; i < count && d.next(rootCtx); i++ {
+		d.launch(func() { convolutionalRun(false, results) })
+	}
+	waitRequests()
+	close(results)
+
+	var records []*RequestResult
+	for rec := range results {
+		records = append(records, rec)
+	}
+	return records
+}
+
+func TestNonStatusErrorFailsTheRequest(t *testing.T) {
+	front := frontFunc(func(context.Context, *pb.ConvolutionalLayerFrontRequest) (*pb.ConvolutionalLayerFrontReply, error) {
+		return nil, errors.New("connection reset by a proxy")
+	})
+	logs := setupRun(t, []pb.FrontClient{front}, "-MaxRetries", "0")
+
+	records := sendRequests(3, 3)
+	if len(records) != 3 {
+		t.Fatalf("got %d records, expected 3", len(records))
+	}
+	for _, rec := range records {
+		if status.Code(rec.Err) != codes.Unknown || rec.Latency != 0 {
+			t.Errorf("request #%d ended with %v in %v, expected Unknown without latency", rec.ID, rec.Err, rec.Latency)
+		}
+	}
+	if failedCount != 3 {
+		t.Errorf("got %d failed requests, expected 3", failedCount)
+	}
+	if got := strings.Count(logs.String(), "Unsuccessful! connection reset by a proxy"); got != 3 {
+		t.Errorf("got %d failure logs, expected 3:\n%s", got, logs)
+	}
+}
+
+func TestRequestSucceeds(t *testing.T) {
+	setupRun(t, []pb.FrontClient{frontFunc(okReply)})
+
+	records := sendRequests(2, 1)
+	if len(records) != 2 {
+		t.Fatalf("got %d records, expected 2", len(records))
+	}
+	for _, rec := range records {
+		if rec.Err != nil || rec.Results != 2 {
+			t.Errorf("request #%d ended with %v and %d results, expected 2 results", rec.ID, rec.Err, rec.Results)
+		}
+	}
+	if completedCount != 2 || failedCount != 0 {
+		t.Errorf("got %d completed and %d failed requests, expected 2 and 0", completedCount, failedCount)
+	}
+}
+
+func TestOversizeRequestTerminates(t *testing.T) {
+	var calls atomic.Int64
+	front := frontFunc(func(ctx context.Context, in *pb.ConvolutionalLayerFrontRequest) (*pb.ConvolutionalLayerFrontReply, error) {
+		calls.Add(1)
+		return okReply(ctx, in)
+	})
+	setupRun(t, []pb.FrontClient{front}, "-MaxMsgSize", "100")
+
+	// a request returning early must still be done, or the wait would hang
+	done := make(chan []*RequestResult)
+	go func() { done <- sendRequests(2, 2) }()
+	var records []*RequestResult
+	select {
+	case records = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the rejected requests are still waited for")
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("got %d records, expected 2", len(records))
+	}
+	for _, rec := range records {
+		if !errors.Is(rec.Err, client.ErrTooLarge) || outcome(rec.Err) != "ClientError" {
+			t.Errorf("request #%d ended with %v, expected a ClientError for a request too large", rec.ID, rec.Err)
+		}
+	}
+	if calls.Load() != 0 {
+		t.Errorf("the front service got %d calls, expected none", calls.Load())
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"sync"
+
+	pb "github.com/gmarseglia/SDCC-Common/proto"
+)
+
+// sharedInput is a request built once for ShareInput, with its target
+type sharedInput struct {
+	request *pb.ConvolutionalLayerFrontRequest
+	target  [][]float32
+}
+
+var (
+	// sharedInputs are keyed by the target size, kernel number and kernel size, as a sweep changes the target size
+	sharedInputs = map[[3]int]*sharedInput{}
+	sharedLock   sync.Mutex
+)
+
+// sharedRequest returns the request built once for the given settings, as request #1 would be, for ShareInput.
+// The matrices are shared by all the requests, read-only, but each gets a message of its own,
+// as the codec tells the calls apart by their messages
+func sharedRequest(targetSize int, kernelNum int, kernelSize int, avgPoolSize int, useKernels bool, useSigmoid bool) (*pb.ConvolutionalLayerFrontRequest, [][]float32, error) {
+	sharedLock.Lock()
+	defer sharedLock.Unlock()
+
+	key := [3]int{targetSize, kernelNum, kernelSize}
+	shared, ok := sharedInputs[key]
+	if !ok {
+		// the lock is held while building, so that the concurrent requests wait for a single generation
+		request, target, err := generateRequest(1, targetSize, kernelNum, kernelSize, avgPoolSize, useKernels, useSigmoid)
+		if err != nil {
+			return nil, nil, err
+		}
+		shared = &sharedInput{request, target}
+		sharedInputs[key] = shared
+		mainLog.Debugf("Shared input built for target size %d, %d kernels of size %d.", targetSize, kernelNum, kernelSize)
+	}
+
+	r := shared.request
+	return &pb.ConvolutionalLayerFrontRequest{
+		Target:      r.Target,
+		Kernel:      r.Kernel,
+		AvgPoolSize: int32(avgPoolSize),
+		UseKernels:  useKernels,
+		UseSigmoid:  useSigmoid,
+	}, shared.target, nil
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	latencies     []time.Duration
+	connectTimes  []time.Duration
+	callTimes     []time.Duration
+	bytesSent     int
+	bytesReceived int
+	statusCounts  = map[string]int{}
+	latenciesLock sync.Mutex
+)
+
+// latencySummary holds the aggregate statistics of a set of latencies
+type latencySummary struct {
+	Count int
+	Min   time.Duration
+	Mean  time.Duration
+	P50   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+	// StdDev is the population standard deviation, and CV the coefficient of variation, StdDev / Mean
+	StdDev time.Duration
+	CV     float64
+}
+
+// recordLatency adds the latency of a successful request to the statistics
+func recordLatency(d time.Duration) {
+	latenciesLock.Lock()
+	defer latenciesLock.Unlock()
+	latencies = append(latencies, d)
+	recordHdr(d)
+}
+
+// recordBreakdown adds the connection and call times of a successful request to the statistics
+func recordBreakdown(connect time.Duration, call time.Duration) {
+	latenciesLock.Lock()
+	defer latenciesLock.Unlock()
+	connectTimes = append(connectTimes, connect)
+	callTimes = append(callTimes, call)
+}
+
+// recordBytes adds the payload sizes of a successful request to the statistics
+func recordBytes(sent int, received int) {
+	latenciesLock.Lock()
+	defer latenciesLock.Unlock()
+	bytesSent += sent
+	bytesReceived += received
+}
+
+// recordStatus counts a measured request by its outcome
+func recordStatus(outcome string) {
+	latenciesLock.Lock()
+	defer latenciesLock.Unlock()
+	statusCounts[outcome]++
+}
+
+// resetLatencies forgets the latencies, their breakdown and the payload sizes recorded so far
+func resetLatencies() {
+	latenciesLock.Lock()
+	defer latenciesLock.Unlock()
+	latencies = nil
+	connectTimes = nil
+	callTimes = nil
+	bytesSent = 0
+	bytesReceived = 0
+	statusCounts = map[string]int{}
+	if hdrHistogram != nil {
+		hdrHistogram.Reset()
+	}
+	profileTallies = map[string]*profileTally{}
+}
+
+// percentile returns the nearest-rank percentile p of the sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank-1, 0)]
+}
+
+// summarizeLatencies computes the statistics of ds, without modifying it
+func summarizeLatencies(ds []time.Duration) latencySummary {
+	if len(ds) == 0 {
+		return latencySummary{}
+	}
+
+	sorted := slices.Clone(ds)
+	slices.Sort(sorted)
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	mean := total / time.Duration(len(sorted))
+
+	// in float64, the squares of the nanoseconds would overflow a Duration
+	var squares float64
+	for _, d := range sorted {
+		diff := float64(d - mean)
+		squares += diff * diff
+	}
+	stdDev := math.Sqrt(squares / float64(len(sorted)))
+	cv := 0.0
+	if mean > 0 {
+		cv = stdDev / float64(mean)
+	}
+
+	return latencySummary{
+		Count:  len(sorted),
+		Min:    sorted[0],
+		Mean:   mean,
+		P50:    percentile(sorted, 50),
+		P95:    percentile(sorted, 95),
+		P99:    percentile(sorted, 99),
+		Max:    sorted[len(sorted)-1],
+		StdDev: time.Duration(stdDev),
+		CV:     cv,
+	}
+}
+
+// ms converts d to fractional milliseconds
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// runTotals holds the outcome counts of the measured requests
+type runTotals struct {
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	Aborted   int `json:"aborted"`
+	// Built counts the requests built by a dry run, none of which was sent
+	Built         int     `json:"built,omitempty"`
+	WallClockMs   float64 `json:"wall_clock_ms"`
+	BytesSent     int     `json:"bytes_sent"`
+	BytesReceived int     `json:"bytes_received"`
+	// StatusCodes counts the requests by the gRPC status code they ended with, OK for the successful ones,
+	// ClientError for those failed by the client itself
+	StatusCodes map[string]int `json:"status_codes"`
+}
+
+// currentTotals returns the outcome counts of the requests so far
+func currentTotals(wallClock time.Duration) runTotals {
+	latenciesLock.Lock()
+	sent, received := bytesSent, bytesReceived
+	codeCounts := map[string]int{}
+	for code, count := range statusCounts {
+		codeCounts[code] = count
+	}
+	latenciesLock.Unlock()
+
+	counterLock.Lock()
+	defer counterLock.Unlock()
+	return runTotals{
+		Succeeded:     completedCount - failedCount,
+		Failed:        failedCount,
+		Aborted:       abortedCount,
+		Built:         builtCount,
+		WallClockMs:   ms(wallClock),
+		BytesSent:     sent,
+		BytesReceived: received,
+		StatusCodes:   codeCounts,
+	}
+}
+
+// statusLine formats counts by status code, from the most frequent, on a single line
+func statusLine(counts map[string]int) string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s: %d", name, counts[name])
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// currentLatencySummary returns the statistics of the latencies recorded so far
+func currentLatencySummary() latencySummary {
+	latenciesLock.Lock()
+	defer latenciesLock.Unlock()
+	return summarizeLatencies(latencies)
+}
+
+// printSummary logs the outcome of the measured requests and their latency statistics
+func printSummary(wallClock time.Duration) {
+	totals := currentTotals(wallClock)
+	succeeded, failed := totals.Succeeded, totals.Failed
+	summary := currentLatencySummary()
+
+	// a dry run sends nothing, so there is nothing to measure
+	if *DryRun {
+		mainLog.Summaryf("Dry run. Built %d requests, none sent. Rejected: %d. Wall-clock time: %v.",
+			totals.Built, failed, wallClock.Round(time.Millisecond))
+		return
+	}
+	mainLog.Summaryf("Summary. Succeeded: %d, Failed: %d, Wall-clock time: %v.",
+		succeeded, failed, wallClock.Round(time.Millisecond))
+	if retries := retryCount.Load(); retries > 0 {
+		mainLog.Summaryf("Retries: %d of %d attempts.", retries, attemptCount.Load())
+	}
+	if injected := injectedCount.Load(); injected > 0 {
+		mainLog.Summaryf("WARNING, %d attempts failed by InjectFailureRate, without contacting the server.", injected)
+	}
+	if *Verify {
+		mainLog.Summaryf("Verification. Verified: %d requests sampled at VerifySample %g, failed: %d.",
+			verifiedCount.Load(), verifySample, verifyFailedCount.Load())
+	}
+	if slow := slowCount.Load(); slow > 0 {
+		mainLog.Summaryf("Slow attempts: %d past SoftTimeout %v.", slow, frontOptions.SoftTimeout)
+	}
+	if len(totals.StatusCodes) > 0 {
+		mainLog.Summaryf("Status codes. %s.", statusLine(totals.StatusCodes))
+	}
+	if seconds := wallClock.Seconds(); seconds > 0 {
+		mainLog.Summaryf("Throughput: %.2f requests per second. Bandwidth sent: %.2f MiB/s, received: %.2f MiB/s.",
+			float64(succeeded)/seconds,
+			float64(totals.BytesSent)/(1024*1024)/seconds,
+			float64(totals.BytesReceived)/(1024*1024)/seconds)
+	}
+	if summary.Count == 0 {
+		return
+	}
+	mainLog.Summaryf("Latency (ms). Min: %.2f, Avg: %.2f, P50: %.2f, P95: %.2f, P99: %.2f, Max: %.2f, StdDev: %.2f, CV: %.2f.",
+		ms(summary.Min), ms(summary.Mean), ms(summary.P50), ms(summary.P95), ms(summary.P99), ms(summary.Max),
+		ms(summary.StdDev), summary.CV)
+
+	latenciesLock.Lock()
+	connect, call := summarizeLatencies(connectTimes), summarizeLatencies(callTimes)
+	latenciesLock.Unlock()
+	mainLog.Summaryf("Latency breakdown (ms). Connection avg: %.2f, P95: %.2f, max: %.2f. Call avg: %.2f, P95: %.2f, max: %.2f.",
+		ms(connect.Mean), ms(connect.P95), ms(connect.Max), ms(call.Mean), ms(call.P95), ms(call.Max))
+}
+
+const histogramWidth = 40
+
+// latencyHistogram counts ds into buckets of equal width, from the minimum to the maximum latency,
+// returning the lower bound of each bucket, and the width
+func latencyHistogram(ds []time.Duration, buckets int) ([]time.Duration, []int, time.Duration) {
+	lowest, highest := slices.Min(ds), slices.Max(ds)
+	width := (highest - lowest) / time.Duration(buckets)
+	if width <= 0 {
+		// all the latencies are in a single bucket
+		buckets, width = 1, max(highest-lowest, 1)
+	}
+
+	bounds := make([]time.Duration, buckets)
+	counts := make([]int, buckets)
+	for i := range bounds {
+		bounds[i] = lowest + width*time.Duration(i)
+	}
+	for _, d := range ds {
+		// the maximum falls in the last bucket, as do the remainders of the division
+		counts[min(int((d-lowest)/width), buckets-1)]++
+	}
+	return bounds, counts, width
+}
+
+// printHistogram logs the distribution of the latencies recorded so far, over buckets bars
+func printHistogram(buckets int) {
+	latenciesLock.Lock()
+	ds := slices.Clone(latencies)
+	latenciesLock.Unlock()
+	if len(ds) == 0 {
+		return
+	}
+
+	bounds, counts, width := latencyHistogram(ds, buckets)
+	highest := slices.Max(counts)
+	mainLog.Summaryf("Latency histogram (ms):")
+	for i, count := range counts {
+		bar := strings.Repeat("#", count*histogramWidth/highest)
+		mainLog.Summaryf("%8.2f - %8.2f | %-*s %d", ms(bounds[i]), ms(bounds[i]+width), histogramWidth, bar, count)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the target sizes of the sweep, nil when not sweeping
+var sweepSizes []int
+
+// sweepRow holds the outcome of the requests of a target size
+type sweepRow struct {
+	targetSize int
+	totals     runTotals
+	latency    latencySummary
+}
+
+// parseSizes parses a comma-separated list of positive sizes
+func parseSizes(list string) ([]int, error) {
+	var sizes []int
+	for _, field := range strings.Split(list, ",") {
+		size, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("invalid size: %q", field)
+		}
+		sizes = append(sizes, size)
+	}
+	return sizes, nil
+}
+
+// runSweep sends the measured requests once per size of the sweep, then reports and exits
+func runSweep(concurrency int, requestCount int) {
+	var rows []sweepRow
+	for _, size := range sweepSizes {
+		*TargetSize = size
+		resetCounters()
+		mainLog.Printf("Sweep. Sending the requests with TargetSize %d...", size)
+
+		// as the measured requests of a single run, with a fresh dispatcher, so also the ramp-up
+		d := newDispatcher(concurrency, launchRate, launchDelay, rampUp)
+		dispatchCtx, cancel := rootCtx, context.CancelFunc(func() {})
+		if runDuration > 0 {
+			dispatchCtx, cancel = context.WithTimeout(rootCtx, runDuration)
+		}
+		results, stopCollecting := collectResults(concurrency)
+		start := time.Now()
+		if *BatchSize > 0 {
+			runBatches(dispatchCtx, requestCount)
+		} else {
+			for i := 0; runDuration > 0 || i < requestCount; i++ {
+				if !d.next(dispatchCtx) {
+					break
+				}
+				d.launch(func() { convolutionalRun(false, results) })
+			}
+		}
+		waitRequests()
+		stopCollecting()
+		cancel()
+
+		wallClock := time.Since(start)
+		printSummary(wallClock)
+		printBatches()
+		// the sizes are tagged intervals of a single log
+		if err := writeHdrInterval(fmt.Sprintf("size-%d", size), start); err != nil {
+			mainLog.Errorf("Could not write HdrOut. More:\n%v", err)
+		}
+		if *PrintIDMap {
+			printIDMap()
+		}
+		rows = append(rows, sweepRow{size, currentTotals(wallClock), currentLatencySummary()})
+		if rootCtx.Err() != nil {
+			break
+		}
+	}
+
+	printSweep(rows)
+	if *CSVOut != "" {
+		path := sweepCSVPath(*CSVOut)
+		if err := writeSweepCSV(path, rows); err != nil {
+			mainLog.Errorf("Could not write the sweep CSV. More:\n%v", err)
+		} else {
+			mainLog.Printf("Sweep written to %s.", path)
+		}
+	}
+
+	if rootCtx.Err() != nil {
+		mainLog.Errorf("Aborted by %s during the sweep, after %d of %d sizes.", abortReason, len(rows), len(sweepSizes))
+		exit(1)
+	}
+	failed := 0
+	for _, row := range rows {
+		failed += row.totals.Failed
+	}
+	if failed > 0 {
+		mainLog.Errorf("%d requests of the sweep failed. Terminating.", failed)
+		exit(1)
+	}
+	exit(0)
+}
+
+var sweepHeader = []string{"target_size", "succeeded", "failed", "min_ms", "mean_ms", "p50_ms", "p95_ms", "p99_ms", "max_ms", "stddev_ms", "cv", "requests_per_second"}
+
+// fields formats the row as the columns of sweepHeader
+func (row sweepRow) fields() []string {
+	l := row.latency
+	perSecond := 0.0
+	if row.totals.WallClockMs > 0 {
+		perSecond = float64(row.totals.Succeeded) / (row.totals.WallClockMs / 1000)
+	}
+	fields := []string{strconv.Itoa(row.targetSize), strconv.Itoa(row.totals.Succeeded), strconv.Itoa(row.totals.Failed)}
+	for _, v := range []float64{ms(l.Min), ms(l.Mean), ms(l.P50), ms(l.P95), ms(l.P99), ms(l.Max), ms(l.StdDev), l.CV, perSecond} {
+		fields = append(fields, strconv.FormatFloat(v, 'f', 2, 64))
+	}
+	return fields
+}
+
+// printSweep logs the rows as a table, a line per size
+func printSweep(rows []sweepRow) {
+	mainLog.Summaryf("Sweep results:")
+	format := strings.Repeat("%12s ", len(sweepHeader)-1) + "%20s"
+	header := make([]any, len(sweepHeader))
+	for i, name := range sweepHeader {
+		header[i] = name
+	}
+	mainLog.Summaryf(format, header...)
+	for _, row := range rows {
+		fields := row.fields()
+		values := make([]any, len(fields))
+		for i, field := range fields {
+			values[i] = field
+		}
+		mainLog.Summaryf(format, values...)
+	}
+}
+
+// sweepCSVPath returns the path of the sweep table next to the CSV of the requests, e.g. runs.sweep.csv for runs.csv
+func sweepCSVPath(csvOut string) string {
+	return strings.TrimSuffix(csvOut, filepath.Ext(csvOut)) + ".sweep.csv"
+}
+
+// writeSweepCSV writes the rows to path, a line per size
+func writeSweepCSV(path string, rows []sweepRow) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write(sweepHeader)
+	for _, row := range rows {
+		w.Write(row.fields())
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
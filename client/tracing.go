@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// tracer is a no-op until setupTracing installs a provider
+var (
+	tracer         = otel.Tracer("sdcc-client")
+	tracerProvider *sdktrace.TracerProvider
+)
+
+// setupTracing exports the spans to the OTLP collector at endpoint, e.g. http://localhost:4317,
+// and propagates the trace context to the front service
+func setupTracing(endpoint string) error {
+	exporter, err := otlptracegrpc.New(context.Background(), otlptracegrpc.WithEndpointURL(endpoint))
+	if err != nil {
+		return err
+	}
+	tracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "sdcc-client"))))
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return nil
+}
+
+// stopTracing flushes the spans not exported yet, waiting at most shutdownGrace
+func stopTracing() {
+	if tracerProvider == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownGrace)
+	defer cancel()
+	if err := tracerProvider.Shutdown(ctx); err != nil {
+		mainLog.Errorf("Could not flush the traces. More:\n%v", err)
+	}
+	tracerProvider = nil
+}